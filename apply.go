@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// A patch section of one file, as produced by git diff.
+type filePatch struct {
+	Path string // Root relative path of the file
+	Text []byte
+}
+
+// Split a git format patch into its files. Paths are made root relative by
+// removing the a/ or b/ prefix.
+func splitPatch(patch []byte) ([]filePatch, error) {
+	var files []filePatch
+	for _, raw := range bytes.SplitAfter(patch, []byte("\n")) {
+		line := string(raw)
+		if strings.HasPrefix(line, "diff --git ") {
+			files = append(files, filePatch{})
+		} else if len(files) == 0 {
+			// Text before the first diff, e.g. a commit message.
+			continue
+		}
+
+		f := &files[len(files)-1]
+		f.Text = append(f.Text, raw...)
+		for _, marker := range []string{"+++ ", "--- "} {
+			if f.Path == "" && strings.HasPrefix(line, marker) {
+				name := strings.TrimSpace(strings.TrimPrefix(line, marker))
+				if name != "/dev/null" {
+					f.Path = stripPatchPrefix(name)
+				}
+			}
+		}
+	}
+
+	for i := range files {
+		if files[i].Path == "" {
+			// No ---/+++ lines, e.g. a mode change or a rename without
+			// changes. Use the header.
+			header := strings.TrimSpace(strings.SplitN(string(files[i].Text), "\n", 2)[0])
+			fields := strings.Fields(header)
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("Can't find the file in %q", header)
+			}
+			files[i].Path = stripPatchPrefix(fields[len(fields)-1])
+		}
+	}
+	return files, nil
+}
+
+func stripPatchPrefix(name string) string {
+	if i := strings.Index(name, "/"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// Number of leading path components git apply must strip for a repo's files
+// in a root relative patch.
+func applyStrip(repo *Repo) int {
+	prefix := RootRelative(repo, "")
+	if prefix == "" {
+		return 1
+	}
+	return 1 + len(strings.Split(prefix, "/"))
+}
+
+// Apply a root relative patch, such as one from gish diff, by giving each
+// repo the files it owns. Repos that applied their part are left as they
+// are when another repo fails.
+func (repo *Repo) Apply(patch []byte, applyArgs []string) error {
+	files, err := splitPatch(patch)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("No changes found in the patch.")
+	}
+
+	byRepo := make(map[*Repo][]byte)
+	for _, f := range files {
+		owner, _, err := repo.Owner(path.Join(repo.Path, f.Path))
+		if err != nil {
+			return err
+		}
+		byRepo[owner] = append(byRepo[owner], f.Text...)
+	}
+
+	var applied, failed []string
+	for _, r := range repo.Repos() {
+		part, ok := byRepo[r]
+		if !ok {
+			continue
+		}
+		args := append([]string{"apply", fmt.Sprintf("-p%d", applyStrip(r))}, applyArgs...)
+		cmd := newCmd(r.Path, nil, "git", args...)
+		cmd.Stdin = bytes.NewReader(part)
+		out, err := cmd.CombinedOutput()
+		logCmdOutput(cmd, out, err)
+		printHeader(r)
+		os.Stdout.Write(out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Git returned error:", err)
+			failed = append(failed, r.Path)
+		} else {
+			applied = append(applied, r.Path)
+		}
+	}
+
+	if len(failed) > 0 {
+		if len(applied) > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: the patch was only partly applied, it was applied in %s\n",
+				strings.Join(applied, ", "))
+		}
+		return fmt.Errorf("The patch failed to apply in %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func cmdApply(args []string, repo *Repo) error {
+	var check, index, threeWay bool
+	flags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	flags.BoolVar(&check, "check", false, "Only check that the patch applies.")
+	flags.BoolVar(&index, "index", false, "Apply the patch to the index as well.")
+	flags.BoolVar(&threeWay, "3way", false, "Fall back to a three way merge if the patch doesn't apply.")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish apply [options] <patch>\n")
+		fmt.Fprint(os.Stderr, "\nApply a patch with root relative paths, such as from 'gish diff', to the repos\n")
+		fmt.Fprint(os.Stderr, "that own its files. Use - to read the patch from stdin.\n")
+		fmt.Fprint(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return &UsageError{flags.Usage, "apply needs a patch file."}
+	}
+
+	var patch []byte
+	var err error
+	if flags.Arg(0) == "-" {
+		patch, err = ioutil.ReadAll(stdinReader)
+	} else {
+		patch, err = ioutil.ReadFile(flags.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+
+	var applyArgs []string
+	if check {
+		applyArgs = append(applyArgs, "--check")
+	}
+	if index {
+		applyArgs = append(applyArgs, "--index")
+	}
+	if threeWay {
+		applyArgs = append(applyArgs, "--3way")
+	}
+	return repo.Apply(patch, applyArgs)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+const testPatch = `Subject: update both
+
+Message text.
+diff --git a/main.c b/main.c
+--- a/main.c
++++ b/main.c
+@@ -1 +1 @@
+-old main
++new main
+diff --git a/libs/a/inner/new.c b/libs/a/inner/new.c
+new file mode 100644
+--- /dev/null
++++ b/libs/a/inner/new.c
+@@ -0,0 +1 @@
++new file
+diff --git a/tool.sh b/tool.sh
+old mode 100644
+new mode 100755
+`
+
+func TestSplitPatch(t *testing.T) {
+	files, err := splitPatch([]byte(testPatch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.Path)
+		if string(f.Text[:11]) != "diff --git " {
+			t.Errorf("%s starts with %q", f.Path, f.Text[:11])
+		}
+	}
+	if want := []string{"main.c", "libs/a/inner/new.c", "tool.sh"}; !sameStrings(paths, want) {
+		t.Errorf("split into %q, want %q", paths, want)
+	}
+
+	if _, err := splitPatch([]byte("diff --git a/x\nindex 1..2\n")); err == nil {
+		t.Error("split a patch without a file")
+	}
+}
+
+func TestApply(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	root := diskTree(t)
+	for _, r := range root.Repos() {
+		runGit(t, r.Path, "init", "-q")
+	}
+	main := filepath.Join(root.Path, "main.c")
+	if err := os.WriteFile(main, []byte("old main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root.Path, "tool.sh"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := applyStrip(&root.Externals[1].Externals[0]); got != 4 {
+		t.Errorf("strip %d components for libs/a/inner", got)
+	}
+	var err error
+	captureStdout(t, func() { err = root.Apply([]byte(testPatch), nil) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]string{
+		main: "new main\n",
+		filepath.Join(root.Path, "libs", "a", "inner", "new.c"): "new file\n",
+	} {
+		if b, err := os.ReadFile(p); err != nil || string(b) != want {
+			t.Errorf("%s is %q, %v", p, b, err)
+		}
+	}
+}
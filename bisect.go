@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Where the state of a bisect of the tree is kept, in the root repo's git dir.
+const bisectRelPath = "info/gish-bisect.json"
+
+// The state of a bisect, narrowing the svn revisions between a good and a
+// bad one with the whole tree checked out at the same revision.
+type bisectState struct {
+	Good, Bad int
+	Current   int               `json:",omitempty"`
+	Heads     map[string]string // Repo path to the branch or commit checked out at the start
+	Tips      map[string]string // Repo path to the commit checked out at the start
+}
+
+// Return the revision halfway between good and bad, or 0 once bad is the
+// revision right after good and the first bad revision has been found.
+func (s *bisectState) next() int {
+	if s.Bad-s.Good <= 1 {
+		return 0
+	}
+	return s.Good + (s.Bad-s.Good)/2
+}
+
+func bisectPath(repo *Repo) string {
+	return path.Join(gitDir(repo.Root.Path), bisectRelPath)
+}
+
+func loadBisect(repo *Repo) (*bisectState, error) {
+	b, err := fsys.ReadFile(bisectPath(repo))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("Not bisecting. Start with 'gish bisect start <bad rev> <good rev>'")
+		}
+		return nil, err
+	}
+	s := new(bisectState)
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("Bad bisect state in %s: %v", bisectPath(repo), err)
+	}
+	return s, nil
+}
+
+func (s *bisectState) save(repo *Repo) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	// A worktree's git dir has no info directory of its own.
+	if err := fsys.MkdirAll(path.Dir(bisectPath(repo)), 0770); err != nil {
+		return err
+	}
+	return fsys.WriteFile(bisectPath(repo), b, 0660)
+}
+
+func parseSvnRev(s string) (int, error) {
+	m := svnRevRegex.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("%q is not an svn revision", s)
+	}
+	return strconv.Atoi(m[1])
+}
+
+// Return the repos that bisect moves: the git-svn repos on disk that are in
+// the same svn repository as the root, since revision numbers mean nothing
+// across svn repositories.
+func bisectRepos(repo *Repo) ([]*Repo, error) {
+	rootRepository, err := repo.Root.repositoryRoot()
+	if err != nil {
+		return nil, err
+	}
+	var repos []*Repo
+	for _, r := range repo.Repos() {
+		if !IsRepo(r.Path) || !isGitSvn(r.Path) {
+			continue
+		}
+		repository, err := r.repositoryRoot()
+		if err != nil {
+			return nil, err
+		}
+		if repository != rootRepository {
+			fmt.Printf("Repo %s is in svn repository %s, leaving it as it is.\n", r.Path, repository)
+			continue
+		}
+		repos = append(repos, r)
+	}
+	return repos, nil
+}
+
+// Check out every repo of the bisect at svn revision rev, searching the
+// history each repo had when the bisect started.
+func (s *bisectState) checkout(repo *Repo, rev int) error {
+	fmt.Printf("Checking out the tree at r%d\n", rev)
+	for _, r := range repo.Repos() {
+		tip, ok := s.Tips[r.Path]
+		if !ok {
+			continue
+		}
+		commit, err := commitAtRev(r.Path, strconv.Itoa(rev), tip)
+		if err != nil {
+			return err
+		}
+		if commit == "" {
+			fmt.Printf("Repo %s has no history at r%d, leaving it as it is.\n", r.Path, rev)
+			continue
+		}
+		_, err = execCmdCapture(r.Path, "git", "checkout", "-q", "--detach", commit)
+		if err != nil {
+			return fmt.Errorf("git checkout %s failed in %s: %v", commit, r.Path, err)
+		}
+	}
+	s.Current = rev
+	return s.save(repo)
+}
+
+// Start a bisect between svn revisions good and bad.
+func (repo *Repo) BisectStart(bad, good int) error {
+	if bad <= good {
+		return fmt.Errorf("The bad revision r%d must be after the good revision r%d", bad, good)
+	}
+	if _, err := fsys.Stat(bisectPath(repo)); err == nil {
+		return fmt.Errorf("Already bisecting, run 'gish bisect reset' first")
+	}
+	if bad == good+1 {
+		fmt.Printf("r%d is the first bad revision\n", bad)
+		return nil
+	}
+
+	repos, err := bisectRepos(repo)
+	if err != nil {
+		return err
+	}
+	s := &bisectState{Good: good, Bad: bad, Heads: make(map[string]string), Tips: make(map[string]string)}
+	for _, r := range repos {
+		state, err := r.Status()
+		if err != nil {
+			return err
+		}
+		if state == stateDirty {
+			return fmt.Errorf("Repo %s has local changes, commit or stash them before bisecting", r.Path)
+		}
+
+		tip, err := execCmdCapture(r.Path, "git", "rev-parse", "HEAD")
+		if err != nil {
+			return fmt.Errorf("git rev-parse HEAD failed in %s: %v", r.Path, err)
+		}
+		s.Tips[r.Path] = strings.TrimSpace(string(tip))
+		s.Heads[r.Path] = s.Tips[r.Path]
+		if branch, err := execCmdCapture(r.Path, "git", "symbolic-ref", "-q", "--short", "HEAD"); err == nil {
+			s.Heads[r.Path] = strings.TrimSpace(string(branch))
+		}
+	}
+	return s.checkout(repo, s.next())
+}
+
+// Mark the revision the tree is at as good or bad and check out the next
+// one to test.
+func (repo *Repo) BisectMark(good bool) error {
+	s, err := loadBisect(repo)
+	if err != nil {
+		return err
+	}
+	if s.Current == 0 {
+		return fmt.Errorf("The first bad revision r%d has been found, run 'gish bisect reset'", s.Bad)
+	}
+	if good {
+		s.Good = s.Current
+	} else {
+		s.Bad = s.Current
+	}
+
+	rev := s.next()
+	if rev == 0 {
+		s.Current = 0
+		fmt.Printf("r%d is the first bad revision\n", s.Bad)
+		return s.save(repo)
+	}
+	fmt.Printf("Bisecting r%d..r%d\n", s.Good, s.Bad)
+	return s.checkout(repo, rev)
+}
+
+// Check out the tree at rev without changing the range being bisected.
+func (repo *Repo) BisectGoto(rev int) error {
+	s, err := loadBisect(repo)
+	if err != nil {
+		return err
+	}
+	return s.checkout(repo, rev)
+}
+
+// End the bisect, checking out what each repo had when it started.
+func (repo *Repo) BisectReset() error {
+	s, err := loadBisect(repo)
+	if err != nil {
+		return err
+	}
+	var failed int
+	for repoPath, head := range s.Heads {
+		_, err := execCmdCapture(repoPath, "git", "checkout", "-q", head)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "git checkout %s failed in %s: %v\n", head, repoPath, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d repo(s) weren't reset, the bisect state is kept in %s", failed, bisectPath(repo))
+	}
+	return fsys.RemoveAll(bisectPath(repo))
+}
+
+func cmdBisect(args []string, repo *Repo) error {
+	flags := flag.NewFlagSet("bisect", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish bisect start <bad rev> <good rev>\n")
+		fmt.Fprint(os.Stderr, "\tgish bisect good|bad\n")
+		fmt.Fprint(os.Stderr, "\tgish bisect goto <rev>\n")
+		fmt.Fprint(os.Stderr, "\tgish bisect reset\n")
+		fmt.Fprint(os.Stderr, "\tFind the first svn revision where the tree is bad, checking out every repo\n")
+		fmt.Fprint(os.Stderr, "\tin the root's svn repository at the same revision.\n")
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return &UsageError{flags.Usage, "A bisect command is required."}
+	}
+
+	sub, subArgs := flags.Arg(0), flags.Args()[1:]
+	var want int
+	switch sub {
+	case "start":
+		want = 2
+	case "goto":
+		want = 1
+	case "good", "bad", "reset":
+	default:
+		return &UsageError{flags.Usage, fmt.Sprintf("Unknown bisect command %q.", sub)}
+	}
+	if len(subArgs) != want {
+		return &UsageError{flags.Usage, fmt.Sprintf("Wrong number of arguments to 'gish bisect %s'.", sub)}
+	}
+	var revs []int
+	for _, a := range subArgs {
+		rev, err := parseSvnRev(a)
+		if err != nil {
+			return &UsageError{flags.Usage, err.Error()}
+		}
+		revs = append(revs, rev)
+	}
+
+	switch sub {
+	case "start":
+		return repo.BisectStart(revs[0], revs[1])
+	case "goto":
+		return repo.BisectGoto(revs[0])
+	case "reset":
+		return repo.BisectReset()
+	}
+	return repo.BisectMark(sub == "good")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBisectNext(t *testing.T) {
+	for _, c := range []struct{ good, bad, want int }{
+		{100, 200, 150},
+		{100, 103, 101},
+		{100, 102, 101},
+		{100, 101, 0},
+	} {
+		s := &bisectState{Good: c.good, Bad: c.bad}
+		if got := s.next(); got != c.want {
+			t.Errorf("next of r%d..r%d is %d, want %d", c.good, c.bad, got, c.want)
+		}
+	}
+}
+
+func TestBisectMark(t *testing.T) {
+	useMemFS(t)
+	repo := testTree()
+	makeRepo(t, repo.Path)
+
+	// No repo has a tip, so checking out only moves Current.
+	s := &bisectState{Good: 100, Bad: 108}
+	captureStdout(t, func() {
+		if err := s.checkout(repo, s.next()); err != nil {
+			t.Fatal(err)
+		}
+		for _, good := range []bool{true, false, true} {
+			if err := repo.BisectMark(good); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	s, err := loadBisect(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 104 good, 106 bad, 105 good.
+	if s.Good != 105 || s.Bad != 106 || s.Current != 0 {
+		t.Errorf("ended at %+v, want r106 found", s)
+	}
+	if err := repo.BisectMark(false); err == nil {
+		t.Error("marking after the bad revision was found wasn't an error")
+	}
+}
+
+func TestParseSvnRev(t *testing.T) {
+	for in, want := range map[string]int{"1234": 1234, "r1234": 1234} {
+		if got, err := parseSvnRev(in); err != nil || got != want {
+			t.Errorf("parsed %q as %d, %v", in, got, err)
+		}
+	}
+	if _, err := parseSvnRev("HEAD"); err == nil {
+		t.Error("HEAD parsed as a revision")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// The limiter command line network commands are run under, with {rate}
+// replaced by -bwlimit.
+const defaultBwLimitCmd = "trickle -s -d {rate} -u {rate}"
+
+var (
+	bwLimit    string // Rate in KB/s to limit network commands to, "" for no limit
+	bwLimitCmd = defaultBwLimitCmd
+
+	bwLimiterOnce  sync.Once
+	bwLimiterFound bool
+)
+
+// Report whether git args talk to a server, svn or git.
+func isNetworkGitCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "clone", "fetch", "pull", "push":
+		return true
+	case "svn":
+		if len(args) < 2 {
+			return false
+		}
+		switch args[1] {
+		case "clone", "fetch", "rebase", "dcommit":
+			return true
+		}
+	}
+	return false
+}
+
+// Return the limiter's command words for the rate, which argv is appended to.
+func bwLimiterArgs(cmdLine, rate string) []string {
+	return strings.Fields(strings.Replace(cmdLine, "{rate}", rate, -1))
+}
+
+// Report whether the limiter can be run, warning once if it can't.
+func bwLimiterAvailable() bool {
+	bwLimiterOnce.Do(func() {
+		words := bwLimiterArgs(bwLimitCmd, bwLimit)
+		if len(words) == 0 {
+			fmt.Fprintln(os.Stderr, "Warning: -bwlimit-cmd is empty, not limiting bandwidth.")
+			return
+		}
+		if _, err := exec.LookPath(words[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s not found, not limiting bandwidth.\n", words[0])
+			return
+		}
+		bwLimiterFound = true
+	})
+	return bwLimiterFound
+}
+
+// Return the command to run for arg0 and args, under the limiter if it is
+// a network git command and -bwlimit is given.
+func bwLimited(arg0 string, args []string) (string, []string) {
+	if bwLimit == "" || arg0 != "git" || !isNetworkGitCommand(args) || !bwLimiterAvailable() {
+		return arg0, args
+	}
+	words := append(bwLimiterArgs(bwLimitCmd, bwLimit), arg0)
+	return words[0], append(words[1:], args...)
+}
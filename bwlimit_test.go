@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestIsNetworkGitCommand(t *testing.T) {
+	for args, want := range map[string]bool{
+		"fetch --all":   true,
+		"push origin":   true,
+		"svn rebase":    true,
+		"svn dcommit":   true,
+		"svn info":      false,
+		"svn":           false,
+		"status":        false,
+		"log --oneline": false,
+		"":              false,
+	} {
+		if got := isNetworkGitCommand(strings.Fields(args)); got != want {
+			t.Errorf("isNetworkGitCommand(%q) is %v", args, got)
+		}
+	}
+}
+
+func TestBwLimited(t *testing.T) {
+	reset := func() {
+		bwLimit, bwLimitCmd = "", defaultBwLimitCmd
+		bwLimiterOnce, bwLimiterFound = sync.Once{}, false
+	}
+	defer reset()
+	fakeCommand(t, "trickle", "exit 0")
+
+	bwLimit = "200"
+	arg0, args := bwLimited("git", []string{"svn", "fetch"})
+	if got := arg0 + " " + strings.Join(args, " "); got != "trickle -s -d 200 -u 200 git svn fetch" {
+		t.Errorf("limited fetch runs %q", got)
+	}
+	if arg0, args := bwLimited("git", []string{"status"}); arg0 != "git" || len(args) != 1 {
+		t.Errorf("status runs under %s %q", arg0, args)
+	}
+
+	reset()
+	bwLimit, bwLimitCmd = "200", "no-such-limiter {rate}"
+	captureOutput(t, &os.Stderr, func() {
+		if arg0, _ := bwLimited("git", []string{"fetch"}); arg0 != "git" {
+			t.Errorf("a missing limiter runs %s", arg0)
+		}
+	})
+}
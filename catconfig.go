@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+)
+
+// Print the stored config exactly as it is, without parsing it, so a corrupt
+// config can be inspected. The file it came from goes to stderr.
+func cmdCatConfig(args []string, _ *Repo) error {
+	flags := flag.NewFlagSet("cat-config", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish cat-config\n")
+		fmt.Fprint(os.Stderr, "\tPrint the raw bytes of the stored config, and name the file they came from on stderr.\n")
+		fmt.Fprint(os.Stderr, "\tUnlike 'gish config --show', the config isn't parsed first.\n")
+	}
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return &UsageError{flags.Usage, "Too many arguments."}
+	}
+
+	location := configFile
+	if location == "" {
+		rootPath, err := FindRootRepoPath()
+		if err != nil {
+			return err
+		}
+		location = rootPath
+	}
+
+	b, source, err := readConfigBytes(location)
+	if err != nil && IsDir(location) {
+		// Trees from before the config was introduced have an externals cache.
+		source = path.Join(location, oldCachePath)
+		b, err = fsys.ReadFile(source)
+	}
+	if err != nil {
+		return fmt.Errorf("No config found in %s", location)
+	}
+
+	fmt.Fprintf(os.Stderr, "# %s\n", source)
+	_, err = os.Stdout.Write(b)
+	return err
+}
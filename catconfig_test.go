@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestCatConfig(t *testing.T) {
+	useMemFS(t)
+	makeRepo(t, "/tree/root")
+	defer func() { configFile = "" }()
+	configFile = "/tree/root"
+
+	if err := cmdCatConfig([]string{"cat-config"}, nil); err == nil {
+		t.Error("a tree without a config wasn't an error")
+	}
+
+	// Not JSON, which cat-config prints anyway.
+	corrupt := "{\"Path\": \"/tree/root\",\x00"
+	if err := fsys.WriteFile(path.Join("/tree/root", cacheRelPath), []byte(corrupt), 0660); err != nil {
+		t.Fatal(err)
+	}
+	var out string
+	stderr := captureOutput(t, &os.Stderr, func() {
+		out = captureStdout(t, func() {
+			if err := cmdCatConfig([]string{"cat-config"}, nil); err != nil {
+				t.Fatal(err)
+			}
+		})
+	})
+	if out != corrupt {
+		t.Errorf("printed %q, want %q", out, corrupt)
+	}
+	if want := "# /tree/root/" + cacheRelPath + "\n"; stderr != want {
+		t.Errorf("named the source %q, want %q", stderr, want)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Exit non-zero if any repo in the tree has changes or is missing, for
+// scripts. Only the repos that aren't clean are named, on stderr.
+func cmdCheckClean(args []string, repo *Repo) error {
+	var quiet bool
+	flags := flag.NewFlagSet("check-clean", flag.ContinueOnError)
+	flags.BoolVar(&quiet, "quiet", false, "Don't name the repos that aren't clean, only set the exit status.")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish check-clean [options]\n")
+		fmt.Fprint(os.Stderr, "\tExit with status 0 if every repo in the tree is clean, non-zero otherwise.\n")
+		fmt.Fprint(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+
+	var unclean int
+	for _, r := range repo.Repos() {
+		state, err := r.Status()
+		if err != nil {
+			return err
+		}
+		if state == stateClean {
+			continue
+		}
+		unclean++
+		if !quiet {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", r.Label(), state)
+		}
+	}
+	if unclean > 0 {
+		return errReported
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckClean(t *testing.T) {
+	root := diskTree(t)
+	resetStatus := func() {
+		statusCache.Lock()
+		statusCache.states = make(map[string]string)
+		statusCache.Unlock()
+	}
+	defer resetStatus()
+
+	fakeGit(t, "exit 0")
+	stderr := captureOutput(t, &os.Stderr, func() {
+		if err := cmdCheckClean([]string{"check-clean"}, root); err != nil {
+			t.Errorf("a clean tree gave %v", err)
+		}
+	})
+	if stderr != "" {
+		t.Errorf("a clean tree printed %q", stderr)
+	}
+
+	resetStatus()
+	fakeGit(t, `case "$PWD" in */libs/b) echo " M file" ;; esac`)
+	inner := &root.Externals[1].Externals[0]
+	if err := os.RemoveAll(filepath.Join(inner.Path, ".git")); err != nil {
+		t.Fatal(err)
+	}
+	stderr = captureOutput(t, &os.Stderr, func() {
+		if err := cmdCheckClean([]string{"check-clean"}, root); err != errReported {
+			t.Errorf("a dirty tree gave %v", err)
+		}
+	})
+	if want := "b: " + stateDirty + "\ninner: " + stateMissing + "\n"; stderr != want {
+		t.Errorf("named %q, want %q", stderr, want)
+	}
+
+	stderr = captureOutput(t, &os.Stderr, func() {
+		if err := cmdCheckClean([]string{"check-clean", "-quiet"}, root); err != errReported {
+			t.Errorf("-quiet gave %v", err)
+		}
+	})
+	if stderr != "" {
+		t.Errorf("-quiet printed %q", stderr)
+	}
+}
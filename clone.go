@@ -0,0 +1,264 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Report whether 'git svn init' has been run in the repo.
+func svnInitialized(repoPath string) bool {
+	_, err := execCmdCombinedOutput(repoPath, "git", "config", "--get", "svn-remote.svn.url")
+	return err == nil
+}
+
+// Split clone arguments into those for 'git svn init' and the revision
+// arguments that only 'git svn fetch' accepts.
+func splitInitFetchArgs(args []string) (initArgs, fetchArgs []string) {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "-r" || a == "--revision":
+			fetchArgs = append(fetchArgs, a)
+			if i+1 < len(args) {
+				i++
+				fetchArgs = append(fetchArgs, args[i])
+			}
+		case strings.HasPrefix(a, "-r") || strings.HasPrefix(a, "--revision="):
+			fetchArgs = append(fetchArgs, a)
+		default:
+			initArgs = append(initArgs, a)
+		}
+	}
+	return initArgs, fetchArgs
+}
+
+// Clone in two steps, 'git svn init' then 'git svn fetch'. git svn fetch
+// picks up where it stopped, so running this again resumes an interrupted
+// clone. init is skipped if it has already been done.
+func (repo *Repo) initFetch() error {
+	existed := IsRepo(repo.Path)
+	if !existed && IsDir(repo.Path) {
+		return fmt.Errorf("Path %s exists but is not a repo.", repo.Path)
+	}
+
+	initArgs, fetchArgs := splitInitFetchArgs(repo.getCheckoutArgs())
+
+	if existed && svnInitialized(repo.Path) {
+		fmt.Printf("Path %s is already initialized, fetching from svn.\n", repo.Path)
+		if err := repo.checkUUID(); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Initializing %q from svn url %q\n", repo.Path, repo.Url)
+		err := fsys.MkdirAll(repo.Path, 0770)
+		if err != nil {
+			return err
+		}
+
+		args := append([]string{"svn", "init"}, initArgs...)
+		err = execCmd(repo.Path, "git", append(args, repo.initUrl())...)
+		if err != nil {
+			return err
+		}
+		if repo.SvnRemote != nil {
+			if err := repo.applySvnRemote(); err != nil {
+				return err
+			}
+		}
+	}
+
+	err := execCmd(repo.Path, "git", append([]string{"svn", "fetch"}, fetchArgs...)...)
+	if err != nil {
+		return err
+	}
+
+	if existed {
+		if repo.holdPinned() {
+			return nil
+		}
+		// Bring the working tree up to date with what was fetched.
+		return execCmd(repo.Path, "git", "svn", "rebase")
+	}
+	return nil
+}
+
+// An external that failed to clone with -skip-failed.
+type cloneFailure struct {
+	Path, Url string
+	Err       error
+}
+
+var failedClones []cloneFailure
+
+// Print a summary of the externals that failed to clone, if any.
+func reportFailedClones() error {
+	if len(failedClones) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(os.Stderr, "These externals failed to clone:")
+	for _, f := range failedClones {
+		fmt.Fprintf(os.Stderr, "\t%s (%s): %v\n", f.Path, f.Url, f.Err)
+	}
+	fmt.Fprintln(os.Stderr, "Run 'gish sync' to retry them.")
+	return fmt.Errorf("%d external(s) failed to clone", len(failedClones))
+}
+
+// Externals pinned to a revision that weren't updated.
+var heldPinned []*Repo
+
+// Report whether the repo is an external pinned to a revision, which updates
+// leave as it is, recording it for reportHeldPinned.
+func (repo *Repo) holdPinned() bool {
+	if repo.Rev == "" {
+		return false
+	}
+	fmt.Printf("Path %s is pinned to r%s, not updating.\n", repo.Path, repo.Rev)
+	heldPinnedMu.Lock()
+	defer heldPinnedMu.Unlock()
+	heldPinned = append(heldPinned, repo)
+	return true
+}
+
+// Print the externals that were held at their pinned revision, if any.
+func reportHeldPinned() {
+	if len(heldPinned) == 0 {
+		return
+	}
+	fmt.Println("These externals are pinned and were not updated:")
+	for _, r := range heldPinned {
+		fmt.Printf("\t%s (r%s)\n", r.Path, r.Rev)
+	}
+}
+
+func cmdClone(args []string, _ *Repo) (err error) {
+	repo, err := NewRepo(args)
+	if err != nil {
+		return err
+	}
+
+	// A new clone has no repo to lock, or pre hook to run, until git-svn has
+	// created it.
+	if IsRepo(repo.Path) {
+		lock, err := repo.Lock()
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+		if err := repo.runPreHook(args[0]); err != nil {
+			return err
+		}
+	}
+	defer func() {
+		if IsRepo(repo.Path) {
+			repo.runPostHook(args[0], err)
+		}
+	}()
+
+	err = repo.Clone()
+	if err != nil {
+		return err
+	}
+
+	// Clone stores the config as it goes, this picks up anything changed since.
+	if werr := repo.WriteConfig(); werr != nil {
+		fmt.Fprintln(os.Stderr, "Error writing config: ", werr)
+	}
+	return reportFailedClones()
+}
+
+// Bring an existing tree up to date: externals in the config that aren't
+// cloned yet are cloned, the rest are updated from svn.
+func cmdSync(args []string, repo *Repo) error {
+	flags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	flags.BoolVar(&skipFailed, "skip-failed", false, "Keep going when an external fails to clone or update.")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish sync [options]\n")
+		fmt.Fprint(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+
+	err := repo.Clone()
+	reportHeldPinned()
+	if err != nil {
+		return err
+	}
+	return reportFailedClones()
+}
+
+var (
+	// Limits the checkouts of a parallel clone, nil when cloning one repo
+	// at a time.
+	cloneThrottle *throttle
+
+	// Guards the Externals of the repos in the tree while a parallel clone
+	// adds to them.
+	treeMu sync.Mutex
+
+	// Keeps the checkout argument prompts of concurrent clones apart.
+	promptMu sync.Mutex
+
+	failedClonesMu sync.Mutex
+	heldPinnedMu   sync.Mutex
+)
+
+// Serializes config writes. A parallel clone writes the config as each
+// external is cloned, so an interrupted clone keeps what was done and the
+// next sync picks up where it stopped.
+var configWriteMu sync.Mutex
+
+// Check out the repo, waiting for a slot if the clone is parallel.
+func (repo *Repo) throttledCheckout() error {
+	if cloneThrottle == nil {
+		return repo.checkout()
+	}
+	release := cloneThrottle.acquire(repo)
+	defer release()
+	return repo.checkout()
+}
+
+// Clone the repo's externals concurrently, each cloning its own externals
+// in turn, limited by cloneThrottle.
+func (repo *Repo) cloneExternalsParallel() error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(repo.Externals))
+	for i := range repo.Externals {
+		if !cloneSelected(&repo.Externals[i]) {
+			treeMu.Lock()
+			filteredOut++
+			treeMu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = repo.Externals[i].Clone()
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if !skipFailed {
+			return err
+		}
+		recordFailedClone(&repo.Externals[i], err)
+	}
+	return nil
+}
+
+func recordFailedClone(ext *Repo, err error) {
+	failedClonesMu.Lock()
+	defer failedClonesMu.Unlock()
+	fmt.Fprintf(os.Stderr, "Cloning %s failed, continuing: %v\n", ext.Path, err)
+	failedClones = append(failedClones, cloneFailure{ext.Path, ext.Url, err})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSplitInitFetchArgs(t *testing.T) {
+	initArgs, fetchArgs := splitInitFetchArgs([]string{
+		"--stdlayout", "-r", "100:HEAD", "--prefix=svn/", "-r200", "--revision=300", "--revision", "BASE", "-q",
+	})
+	if want := []string{"--stdlayout", "--prefix=svn/", "-q"}; !sameStrings(initArgs, want) {
+		t.Errorf("init args %q, want %q", initArgs, want)
+	}
+	if want := []string{"-r", "100:HEAD", "-r200", "--revision=300", "--revision", "BASE"}; !sameStrings(fetchArgs, want) {
+		t.Errorf("fetch args %q, want %q", fetchArgs, want)
+	}
+
+	// A trailing -r without its revision still goes to fetch, which rejects it.
+	if _, fetchArgs := splitInitFetchArgs([]string{"-r"}); !sameStrings(fetchArgs, []string{"-r"}) {
+		t.Errorf("fetch args %q", fetchArgs)
+	}
+}
+
+func TestReportFailedClones(t *testing.T) {
+	defer func() { failedClones = nil }()
+	if err := reportFailedClones(); err != nil {
+		t.Errorf("no failures reported %v", err)
+	}
+
+	failedClones = []cloneFailure{
+		{"/tree/root/libs/a", "svn://other.example.com/a", errors.New("authorization failed")},
+		{"/tree/root/libs/b", "https://svn.example.com/repo/libs/b", errors.New("no such path")},
+	}
+	if err := reportFailedClones(); err == nil || !strings.Contains(err.Error(), "2 external(s)") {
+		t.Errorf("two failures reported %v", err)
+	}
+}
+
+// Config writes from concurrent clones are serialized against each other and
+// against externals being added to the tree.
+func TestConcurrentConfigWrites(t *testing.T) {
+	useMemFS(t)
+	makeRepo(t, "/tree/root")
+	root := testTree()
+	b := &root.Externals[0]
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			treeMu.Lock()
+			b.Externals = append(b.Externals, Repo{Path: fmt.Sprintf("%s/ext%d", b.Path, i),
+				Url: fmt.Sprintf("%s/ext%d", b.Url, i), Root: root})
+			treeMu.Unlock()
+			if err := b.WriteConfig(); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	loaded, err := LoadConfig(root.ConfigPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(loaded.Repos()), len(root.Repos()); got != want {
+		t.Errorf("stored %d repos, want %d", got, want)
+	}
+}
+
+// Clone a tree whose root is checked out, returning the git commands run,
+// each after the directory it ran in.
+func cloneCommands(t *testing.T, root *Repo) []string {
+	calls := filepath.Join(t.TempDir(), "calls")
+	fakeGit(t, `echo "$PWD $*" >> `+calls+`; case "$1" in config) exit 1;; esac`)
+	captureStdout(t, func() {
+		if err := root.Clone(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	b, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
+
+func TestCloneNoExternals(t *testing.T) {
+	root := diskTree(t)
+	for _, r := range root.Repos()[1:] {
+		if err := os.RemoveAll(r.Path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	noExternals = true
+	defer func() { noExternals = false }()
+
+	calls := cloneCommands(t, root)
+	for _, c := range calls {
+		if !strings.HasPrefix(c, root.Path+" ") {
+			t.Errorf("ran in an external: %s", c)
+		}
+	}
+	if !root.Partial {
+		t.Error("a clone without externals isn't partial")
+	}
+	for _, r := range root.Repos()[1:] {
+		if cloneSelected(r) || IsDir(r.Path) {
+			t.Errorf("%s was cloned", r.Path)
+		}
+	}
+	// As cmdClone does after the clone.
+	if err := root.WriteConfig(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadConfig(root.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Partial || len(loaded.Repos()) != 4 {
+		t.Errorf("stored a tree of %d repos, partial %v", len(loaded.Repos()), loaded.Partial)
+	}
+}
+
+func TestSyncHoldsPinned(t *testing.T) {
+	root := diskTree(t)
+	a := &root.Externals[1]
+	a.Externals[0].ExternalsKnown = true
+	defer func() { heldPinned = nil }()
+
+	calls := strings.Join(cloneCommands(t, root), "\n")
+	for _, r := range root.Repos() {
+		rebased := strings.Contains(calls, r.Path+" svn rebase")
+		if rebased == (r == a) {
+			t.Errorf("%s (r%q) rebased: %v", r.Path, r.Rev, rebased)
+		}
+	}
+	if len(heldPinned) != 1 || heldPinned[0] != a {
+		t.Errorf("held %q", repoPaths(heldPinned))
+	}
+	out := captureStdout(t, reportHeldPinned)
+	if !strings.Contains(out, "\t"+a.Path+" (r12)\n") {
+		t.Errorf("reported\n%s", out)
+	}
+}
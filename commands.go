@@ -0,0 +1,149 @@
+package main
+
+import (
+	"sort"
+)
+
+// A Command is a gish subcommand. Commands that aren't registered are passed
+// to git in each repo.
+type Command struct {
+	Name    string
+	Summary string // One line description for the command list
+
+	// Run performs the command. args includes the command name. repo is the
+	// loaded tree, or nil if NoRepo is set.
+	Run func(args []string, repo *Repo) error
+
+	// NoRepo commands run without loading the tree, or load it themselves.
+	NoRepo bool
+
+	// ReadOnly commands don't modify the tree, so they run without taking its
+	// lock. Commands passed to git always take the lock.
+	ReadOnly bool
+
+	// SavesConfig commands store the config as they make progress, so it isn't
+	// written again when they fail.
+	SavesConfig bool
+
+	// Hidden commands are left out of the command list and completion.
+	Hidden bool
+}
+
+var commands = make(map[string]*Command)
+
+func register(c *Command) {
+	commands[c.Name] = c
+}
+
+// Return the names of the registered commands that aren't hidden, in sorted
+// order.
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name, c := range commands {
+		if !c.Hidden {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	register(&Command{Name: "clone", Summary: "clone an svn repo and its externals.",
+		Run: cmdClone, NoRepo: true})
+	register(&Command{Name: "sync", Summary: "clone missing externals and update the rest from svn.",
+		Run: cmdSync, SavesConfig: true})
+	register(&Command{Name: "list", Summary: "list the root path of the current git repo and the paths to its externals.",
+		Run: cmdList, ReadOnly: true})
+	register(&Command{Name: "status", Summary: "git status in each repo, or a summary with --porcelain.",
+		Run: cmdStatus, ReadOnly: true})
+	register(&Command{Name: "fetch", Summary: "git fetch in each repo, or --prune-branches to fetch from svn and drop deleted branches.",
+		Run: cmdFetch})
+	register(&Command{Name: "clean", Summary: "perform git clean without removing externals.",
+		Run: cmdClean})
+	register(&Command{Name: "updateignores", Summary: "add externals to git ignore. Done automatically with clone.",
+		Run: func(args []string, repo *Repo) error {
+			repo.IgnoreAllExternals()
+			return nil
+		}})
+	register(&Command{Name: "foreach", Summary: "run a git command in a selection of the repos.",
+		Run: cmdForeach})
+	register(&Command{Name: "reauth", Summary: "authenticate once with each svn server used by the repos.",
+		Run: func(args []string, repo *Repo) error {
+			return repo.Reauth()
+		}})
+	register(&Command{Name: "each-server", Summary: "run a git command once per svn server.",
+		Run: cmdEachServer})
+	register(&Command{Name: "whoami", Summary: "show the svn user each server is authenticated as.",
+		Run: cmdWhoami, ReadOnly: true})
+	register(&Command{Name: "unshallow", Summary: "fetch the svn history missing from repos cloned from a later revision.",
+		Run: cmdUnshallow})
+	register(&Command{Name: "tag", Summary: "tag the current commit of every repo.",
+		Run: cmdTag})
+	register(&Command{Name: "prune", Summary: "remove external directories no longer in the config.",
+		Run: cmdPrune})
+	register(&Command{Name: "prune-worktrees", Summary: "remove the entries of worktrees whose directories were deleted.",
+		Run: cmdPruneWorktrees})
+	register(&Command{Name: "resolve", Summary: "print the url an svn external resolves to.",
+		Run: cmdResolve, NoRepo: true})
+	register(&Command{Name: "ls-files", Summary: "git ls-files in all repos, with paths relative to the root.",
+		Run: cmdLsFiles, ReadOnly: true})
+	register(&Command{Name: "grep", Summary: "git grep in all repos, with paths relative to the root.",
+		Run: cmdGrep, ReadOnly: true})
+	register(&Command{Name: "diff", Summary: "git diff of all repos as one patch, with paths relative to the root.",
+		Run: cmdDiff, ReadOnly: true})
+	register(&Command{Name: "diff-revs", Summary: "git diff of all repos between two svn revisions, as one patch.",
+		Run: cmdDiffRevs, ReadOnly: true})
+	register(&Command{Name: "apply", Summary: "apply a patch from gish diff to the repos that own its files.",
+		Run: cmdApply})
+	register(&Command{Name: "check-clean", Summary: "exit non-zero if any repo has changes, for scripts.",
+		Run: cmdCheckClean, ReadOnly: true})
+	register(&Command{Name: "diff-config", Summary: "show how the externals in svn differ from the stored config.",
+		Run: cmdDiffConfig, ReadOnly: true})
+	register(&Command{Name: "log", Summary: "git log in each repo, --since rN for the commits after an svn revision.",
+		Run: cmdGitLog, ReadOnly: true})
+	register(&Command{Name: "doctor", Summary: "check the repos, externals and config for problems.",
+		Run: cmdDoctor})
+	register(&Command{Name: "which", Summary: "print the repo a path belongs to.",
+		Run: cmdWhich, ReadOnly: true})
+	register(&Command{Name: "open", Summary: "print the svn url of a path, or open it in the browser.",
+		Run: cmdOpen, ReadOnly: true})
+	register(&Command{Name: "shell", Summary: "run commands against the tree without reloading it for each.",
+		Run: cmdShell, ReadOnly: true})
+	register(&Command{Name: "relocate", Summary: "move the tree to a new directory and update its config.",
+		Run: cmdRelocate, NoRepo: true})
+	register(&Command{Name: "relink", Summary: "repair the paths in the config of a tree moved by hand.",
+		Run: cmdRelink})
+	register(&Command{Name: "mirror", Summary: "make a bare mirror of the root repo that carries the config.",
+		Run: cmdMirror, ReadOnly: true})
+	register(&Command{Name: "fsck", Summary: "run git fsck in every repo and list those with problems.",
+		Run: cmdFsck, ReadOnly: true})
+	register(&Command{Name: "count", Summary: "summarize the number of repos and their size.",
+		Run: cmdCount, ReadOnly: true})
+	register(&Command{Name: "remote-url", Summary: "print or rewrite the svn url of each repo.",
+		Run: cmdRemoteUrl})
+	register(&Command{Name: "completion", Summary: "print a bash or zsh completion script.",
+		Run: cmdCompletion, NoRepo: true})
+	register(&Command{Name: "export-manifest", Summary: "write the tree's urls and relative paths for clone -manifest.",
+		Run: cmdExportManifest, ReadOnly: true})
+	register(&Command{Name: "env", Summary: "print the settings gish uses, after flags and the environment.",
+		Run: cmdEnv, NoRepo: true})
+	register(&Command{Name: "verify-urls", Summary: "check that the svn url of every repo can be reached.",
+		Run: cmdVerifyUrls, ReadOnly: true})
+	register(&Command{Name: "config", Summary: "git config in each repo, or --show or --edit the gish config.",
+		Run: cmdConfig})
+	register(&Command{Name: "cat-config", Summary: "print the stored config as it is, without parsing it.",
+		Run: cmdCatConfig, NoRepo: true})
+	register(&Command{Name: "dcommit", Summary: "preview the commits to send to svn from each repo, then git svn dcommit them.",
+		Run: cmdDcommit})
+	register(&Command{Name: "root", Summary: "print the path of the tree's root repo.",
+		Run: cmdRoot, NoRepo: true})
+	register(&Command{Name: "bisect", Summary: "find the first bad svn revision, moving the whole tree between revisions.",
+		Run: cmdBisect})
+	register(&Command{Name: "selfcheck", Summary: "clone a tiny local svn repo with an external to check gish works here.",
+		Run: cmdSelfcheck, NoRepo: true, Hidden: true})
+	register(&Command{Name: "snapshot", Summary: "record the commit of every repo in a file for restore.",
+		Run: cmdSnapshot, ReadOnly: true})
+	register(&Command{Name: "restore", Summary: "check out the commits recorded by snapshot.",
+		Run: cmdRestore})
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestCommandNames(t *testing.T) {
+	names := commandNames()
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("names aren't sorted: %q", names)
+	}
+	listed := make(map[string]bool)
+	for _, name := range names {
+		listed[name] = true
+	}
+	for _, name := range []string{"clone", "list", "status"} {
+		if !listed[name] {
+			t.Errorf("%s isn't listed", name)
+		}
+	}
+	if listed["selfcheck"] {
+		t.Error("the hidden selfcheck command is listed")
+	}
+
+	for name, c := range commands {
+		if c.Name != name || c.Run == nil || c.Summary == "" {
+			t.Errorf("command %s is registered as %+v", name, c)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Report whether a flag is given without a value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// Return the names of the global flags, with their dash, split into those
+// that are given alone and those that take a value.
+func globalFlagNames() (bools, values []string) {
+	flag.VisitAll(func(f *flag.Flag) {
+		if isBoolFlag(f) {
+			bools = append(bools, "-"+f.Name)
+		} else {
+			values = append(values, "-"+f.Name)
+		}
+	})
+	return bools, values
+}
+
+// Write a bash completion function for gish. It completes the commands and
+// the global flags before the command, and file names after it.
+func writeBashCompletion(w io.Writer) {
+	bools, values := globalFlagNames()
+	fmt.Fprintf(w, `# bash completion for gish. Load it with: source <(gish completion bash)
+_gish() {
+	local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+	local i cmd
+	for ((i = 1; i < COMP_CWORD; i++)); do
+		case ${COMP_WORDS[i]} in
+		%s) ((i++)) ;;
+		-*) ;;
+		*) cmd=${COMP_WORDS[i]}; break ;;
+		esac
+	done
+
+	if [[ -n $cmd ]]; then
+		COMPREPLY=($(compgen -f -- "$cur"))
+	elif [[ $prev == @(%s) ]]; then
+		COMPREPLY=($(compgen -f -- "$cur"))
+	elif [[ $cur == -* ]]; then
+		COMPREPLY=($(compgen -W "%s" -- "$cur"))
+	else
+		COMPREPLY=($(compgen -W "%s" -- "$cur"))
+	fi
+}
+complete -o filenames -F _gish gish
+`, strings.Join(values, "|"), strings.Join(values, "|"),
+		strings.Join(append(bools, values...), " "), strings.Join(commandNames(), " "))
+}
+
+// Quote s for a zsh completion spec between single quotes, escaping the
+// characters _arguments and _describe give a meaning.
+func zshQuote(s string) string {
+	r := strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`)
+	return r.Replace(s)
+}
+
+// Write a zsh completion function for gish, with the command summaries and
+// flag descriptions.
+func writeZshCompletion(w io.Writer) {
+	fmt.Fprint(w, "#compdef gish\n# zsh completion for gish. Load it with: source <(gish completion zsh)\n")
+	fmt.Fprint(w, "_gish() {\n\tlocal -a cmds\n\tcmds=(\n")
+	for _, name := range commandNames() {
+		fmt.Fprintf(w, "\t\t'%s:%s'\n", zshQuote(name), zshQuote(commands[name].Summary))
+	}
+	fmt.Fprint(w, "\t)\n\t_arguments -C \\\n")
+	flag.VisitAll(func(f *flag.Flag) {
+		spec := fmt.Sprintf("-%s[%s]", f.Name, zshQuote(f.Usage))
+		if !isBoolFlag(f) {
+			spec += ":" + f.Name + ":_files"
+		}
+		fmt.Fprintf(w, "\t\t'%s' \\\n", spec)
+	})
+	fmt.Fprint(w, "\t\t'1:command:->cmd' \\\n\t\t'*::file:_files'\n")
+	fmt.Fprint(w, "\tcase $state in\n\tcmd) _describe command cmds ;;\n\tesac\n}\ncompdef _gish gish\n")
+}
+
+func cmdCompletion(args []string, _ *Repo) error {
+	flags := flag.NewFlagSet("completion", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish completion bash|zsh\n")
+		fmt.Fprint(os.Stderr, "\tPrint a shell completion script for gish's commands and global options.\n")
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return &UsageError{flags.Usage, "A single shell is required."}
+	}
+
+	switch flags.Arg(0) {
+	case "bash":
+		writeBashCompletion(os.Stdout)
+	case "zsh":
+		writeZshCompletion(os.Stdout)
+	default:
+		return &UsageError{flags.Usage, fmt.Sprintf("Shell %s isn't supported.", flags.Arg(0))}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Run the bash completion for the words of a command line whose last word
+// is being completed, returning the candidates.
+func completeBash(t *testing.T, script, line string) []string {
+	words := strings.Split(line, " ")
+	var quoted []string
+	for _, w := range words {
+		quoted = append(quoted, "'"+w+"'")
+	}
+	prog := script + "\nCOMP_WORDS=(" + strings.Join(quoted, " ") + ")\n" +
+		"COMP_CWORD=" + strconv.Itoa(len(words)-1) + "\n" +
+		"_gish\nprintf '%s\\n' \"${COMPREPLY[@]}\"\n"
+	out, err := exec.Command("bash", "-O", "extglob", "-c", prog).CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash failed: %v\n%s", err, out)
+	}
+	return strings.Fields(string(out))
+}
+
+func TestBashCompletion(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash isn't installed")
+	}
+	var b bytes.Buffer
+	writeBashCompletion(&b)
+	script := b.String()
+
+	if got := completeBash(t, script, "gish cl"); !sameStrings(got, []string{"clean", "clone"}) {
+		t.Errorf("gish cl completed to %q", got)
+	}
+	// After the command, or a flag's value, file names are completed.
+	for _, line := range []string{"gish status completion_t", "gish -test.run completion_t"} {
+		if got := completeBash(t, script, line); !sameStrings(got, []string{"completion_test.go"}) {
+			t.Errorf("%q completed to %q", line, got)
+		}
+	}
+	if got := completeBash(t, script, "gish -test.cou"); !sameStrings(got, []string{"-test.count"}) {
+		t.Errorf("-test.cou completed to %q", got)
+	}
+}
+
+func TestZshCompletion(t *testing.T) {
+	var b bytes.Buffer
+	writeZshCompletion(&b)
+	script := b.String()
+	for _, want := range []string{"#compdef gish\n", "'clone:clone an svn repo and its externals.'", "compdef _gish gish\n"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("no %q in\n%s", want, script)
+		}
+	}
+	if strings.Contains(script, "'selfcheck:") {
+		t.Error("the hidden selfcheck command is completed")
+	}
+	if got := zshQuote("a [b]: it's"); got != `a \[b\]\: it'\''s` {
+		t.Errorf("quoted to %s", got)
+	}
+}
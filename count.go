@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Counts summarize the size of a tree.
+type Counts struct {
+	Repos    int   // The root and all externals
+	MaxDepth int   // Nesting depth of the deepest external, 0 for the root alone
+	Size     int64 // Bytes on disk
+}
+
+// Return the number of repos in the tree and the depth of its deepest external.
+func (repo *Repo) countRepos() (repos, maxDepth int) {
+	repos = 1
+	for i := range repo.Externals {
+		n, d := repo.Externals[i].countRepos()
+		repos += n
+		if d+1 > maxDepth {
+			maxDepth = d + 1
+		}
+	}
+	return repos, maxDepth
+}
+
+// Return the bytes used by the files of the repo, not counting its externals,
+// which are measured on their own.
+func (repo *Repo) diskUsage() (int64, error) {
+	skip := make(map[string]bool, len(repo.Externals))
+	for _, ext := range repo.Externals {
+		skip[filepath.Clean(ext.Path)] = true
+	}
+
+	var size int64
+	err := filepath.Walk(repo.Path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() && skip[p] {
+			return filepath.SkipDir
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+func (repo *Repo) Count() (Counts, error) {
+	var c Counts
+	c.Repos, c.MaxDepth = repo.countRepos()
+
+	for _, r := range repo.Repos() {
+		size, err := r.diskUsage()
+		if err != nil {
+			return c, err
+		}
+		c.Size += size
+	}
+	return c, nil
+}
+
+func cmdCount(args []string, repo *Repo) error {
+	var asJson bool
+	flags := flag.NewFlagSet("count", flag.ContinueOnError)
+	flags.BoolVar(&asJson, "json", false, "Print the counts as JSON.")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish count [options]\n")
+		fmt.Fprint(os.Stderr, "\tPrint the number of repos, the deepest external nesting and the size on disk.\n")
+		fmt.Fprint(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+
+	c, err := repo.Count()
+	if err != nil {
+		return err
+	}
+
+	if asJson {
+		b, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	fmt.Printf("repos: %d, max depth: %d, size: %d bytes\n", c.Repos, c.MaxDepth, c.Size)
+	return nil
+}
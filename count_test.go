@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	dir := t.TempDir()
+	root := &Repo{Path: dir, Externals: []Repo{
+		{Path: filepath.Join(dir, "libs", "b")},
+		{Path: filepath.Join(dir, "libs", "a"),
+			Externals: []Repo{{Path: filepath.Join(dir, "libs", "a", "inner")}}},
+	}}
+	root.LinkRoot()
+	for name, size := range map[string]int{
+		"main.c":                 10,
+		"libs/b/b.c":             20,
+		"libs/a/a.c":             30,
+		"libs/a/inner/inner.c":   40,
+		"libs/a/inner/.git/HEAD": 5,
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0770); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, size), 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := root.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Counts{Repos: 4, MaxDepth: 2, Size: 105}); c != want {
+		t.Errorf("counted %+v, want %+v", c, want)
+	}
+
+	// A missing external counts as a repo with nothing on disk.
+	if err := os.RemoveAll(filepath.Join(dir, "libs", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := root.Count(); err != nil || c.Size != 85 {
+		t.Errorf("without libs/b counted %+v, %v", c, err)
+	}
+}
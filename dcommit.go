@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// git svn dcommit --dry-run prints a diff-tree line for each commit it would
+// send to svn.
+var dryRunCommitRegex = regexp.MustCompile(`(?m)^diff-tree ([0-9a-f]+)~1 ([0-9a-f]+)`)
+
+// Return a one line summary of each commit git svn dcommit would send to svn
+// from the repo, oldest first.
+func pendingDcommits(repoPath string) ([]string, error) {
+	out, err := execCmdCapture(repoPath, "git", "svn", "dcommit", "--dry-run")
+	if err != nil {
+		return nil, fmt.Errorf("git svn dcommit --dry-run failed in %s: %v\n%s", repoPath, err, out)
+	}
+
+	var commits []string
+	for _, m := range dryRunCommitRegex.FindAllSubmatch(out, -1) {
+		summary, err := execCmdCapture(repoPath, "git", "log", "-1", "--format=%h %s", string(m[2]))
+		if err != nil {
+			return nil, fmt.Errorf("git log failed in %s: %v", repoPath, err)
+		}
+		commits = append(commits, strings.TrimSpace(string(summary)))
+	}
+	return commits, nil
+}
+
+// Show what git svn dcommit would send to svn from each repo and, once
+// confirmed, dcommit them. Externals are dcommitted before the repos that
+// contain them.
+func Dcommit(repos []*Repo, yes bool) error {
+	var pushing []*Repo
+	var total int
+	for _, r := range repos {
+		commits, err := pendingDcommits(r.Path)
+		if err != nil {
+			return err
+		}
+		if len(commits) == 0 {
+			continue
+		}
+		printHeader(r)
+		for _, c := range commits {
+			fmt.Printf("\t%s\n", c)
+		}
+		pushing = append(pushing, r)
+		total += len(commits)
+	}
+
+	if total == 0 {
+		fmt.Println("Nothing to dcommit.")
+		return nil
+	}
+	if !yes && !confirm(fmt.Sprintf("Dcommit %d commit(s) from %d repo(s) to svn?", total, len(pushing))) {
+		return fmt.Errorf("Dcommit cancelled")
+	}
+
+	for _, r := range pushing {
+		printHeader(r)
+		err := execCmd(r.Path, "git", "svn", "dcommit")
+		if err != nil {
+			return fmt.Errorf("git svn dcommit failed in %s, the repos after it weren't dcommitted: %v", r.Path, err)
+		}
+	}
+	return nil
+}
+
+func cmdDcommit(args []string, repo *Repo) error {
+	var yes bool
+	flags := flag.NewFlagSet("dcommit", flag.ContinueOnError)
+	flags.BoolVar(&yes, "yes", false, "Dcommit without asking for confirmation after the preview.")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish dcommit [options]\n")
+		fmt.Fprint(os.Stderr, "\tPreview the commits each repo would send to svn, then git svn dcommit them.\n")
+		fmt.Fprint(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+
+	return Dcommit(gitSvnOnly(presentOnly(repo.ReposPostOrder())), yes)
+}
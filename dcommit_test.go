@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDcommit(t *testing.T) {
+	root := diskTree(t)
+	logFile := filepath.Join(t.TempDir(), "log")
+	fakeGit(t, `case "$*" in
+"svn dcommit --dry-run")
+	case "$PWD" in
+	*/libs/b) echo "diff-tree 2222~1 2222"; echo "diff-tree 3333~1 3333" ;;
+	esac ;;
+"svn dcommit") echo "$PWD" >> `+logFile+` ;;
+log*) echo "$4 summary" ;;
+esac`)
+
+	b := root.Externals[0]
+	out := captureStdout(t, func() {
+		if err := Dcommit(root.ReposPostOrder(), true); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if !strings.Contains(out, "\t2222 summary\n\t3333 summary\n") {
+		t.Errorf("preview is %q", out)
+	}
+	got, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != b.Path+"\n" {
+		t.Errorf("dcommitted in %q, want only %s", got, b.Path)
+	}
+
+	fakeGit(t, "exit 0")
+	out = captureStdout(t, func() {
+		if err := Dcommit(root.Repos(), true); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if out != "Nothing to dcommit.\n" {
+		t.Errorf("nothing pending printed %q", out)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// A ConfigChange is an external that differs between the stored config and
+// the tree derived from svn.
+type ConfigChange struct {
+	Kind   byte // '+' added, '-' removed or '~' url changed
+	Path   string
+	OldUrl string
+	NewUrl string
+}
+
+func (c ConfigChange) String() string {
+	switch c.Kind {
+	case '+':
+		return fmt.Sprintf("+ %s %s", c.Path, c.NewUrl)
+	case '-':
+		return fmt.Sprintf("- %s %s", c.Path, c.OldUrl)
+	}
+	return fmt.Sprintf("~ %s %s -> %s", c.Path, c.OldUrl, c.NewUrl)
+}
+
+// Derive the tree afresh from the externals properties of the repos that are
+// checked out. Externals that aren't checked out are left with
+// ExternalsKnown unset, as their own externals can't be read.
+func (repo *Repo) DeriveTree() (*Repo, error) {
+	// The root's clone settings decide where externals go.
+	fresh := &Repo{Path: repo.Path, Url: repo.Url, CheckoutArgs: repo.CheckoutArgs,
+		PathRemap: repo.PathRemap, Partial: repo.Partial}
+	fresh.LinkRoot()
+	return fresh, fresh.deriveExternals()
+}
+
+func (repo *Repo) deriveExternals() error {
+	rawExternals, err := repo.rawExternals()
+	if err != nil {
+		return err
+	}
+	err = repo.CookExternals(rawExternals)
+	if err != nil {
+		return err
+	}
+
+	for i := range repo.Externals {
+		ext := &repo.Externals[i]
+		if !IsRepo(ext.Path) {
+			continue
+		}
+		if err := ext.deriveExternals(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compare the externals of two trees by path. The externals of repos whose
+// externals aren't known in fresh aren't compared.
+func DiffConfig(stored, fresh *Repo) []ConfigChange {
+	var changes []ConfigChange
+	diffExternals(stored, fresh, &changes)
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func diffExternals(stored, fresh *Repo, changes *[]ConfigChange) {
+	if !fresh.ExternalsKnown {
+		return
+	}
+
+	old := make(map[string]*Repo)
+	for i := range stored.Externals {
+		old[path.Clean(stored.Externals[i].Path)] = &stored.Externals[i]
+	}
+
+	for i := range fresh.Externals {
+		ext := &fresh.Externals[i]
+		p := path.Clean(ext.Path)
+		o, ok := old[p]
+		if !ok {
+			*changes = append(*changes, ConfigChange{Kind: '+', Path: p, NewUrl: ext.Url})
+			continue
+		}
+		delete(old, p)
+		if o.Url != ext.Url {
+			*changes = append(*changes, ConfigChange{Kind: '~', Path: p, OldUrl: o.Url, NewUrl: ext.Url})
+		}
+		diffExternals(o, ext, changes)
+	}
+
+	for p, o := range old {
+		*changes = append(*changes, ConfigChange{Kind: '-', Path: p, OldUrl: o.Url})
+	}
+}
+
+func cmdDiffConfig(args []string, repo *Repo) error {
+	flags := flag.NewFlagSet("diff-config", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish diff-config\n")
+		fmt.Fprint(os.Stderr, "\nShow the externals that were added, removed or changed in svn since the config was stored.\n")
+		fmt.Fprint(os.Stderr, "Changed lines are '+ path url', '- path url' and '~ path old -> new'.\n")
+	}
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return &UsageError{flags.Usage, "diff-config takes no arguments."}
+	}
+
+	fresh, err := repo.DeriveTree()
+	if err != nil {
+		return err
+	}
+
+	changes := DiffConfig(repo, fresh)
+	for _, c := range changes {
+		if rel, err := filepath.Rel(repo.Path, c.Path); err == nil {
+			c.Path = filepath.ToSlash(rel)
+		}
+		fmt.Println(c)
+	}
+	if len(changes) == 0 {
+		fmt.Println("The config matches the externals in svn.")
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestDiffConfig(t *testing.T) {
+	stored := testTree()
+	fresh := testTree()
+	if changes := DiffConfig(stored, fresh); len(changes) != 0 {
+		t.Errorf("identical trees differ: %v", changes)
+	}
+
+	fresh.Externals[0].Url = "https://svn.example.com/repo/libs/b2"
+	fresh.Externals[1].Externals = nil
+	fresh.Externals = append(fresh.Externals, Repo{Path: "/tree/root/libs/c", Url: "https://svn.example.com/repo/libs/c"})
+	fresh.LinkRoot()
+	want := []string{
+		"- /tree/root/libs/a/inner svn://other.example.com/inner",
+		"~ /tree/root/libs/b https://svn.example.com/repo/libs/b -> https://svn.example.com/repo/libs/b2",
+		"+ /tree/root/libs/c https://svn.example.com/repo/libs/c",
+	}
+	var got []string
+	for _, c := range DiffConfig(stored, fresh) {
+		got = append(got, c.String())
+	}
+	if !sameStrings(got, want) {
+		t.Errorf("changes are\n%q\nwant\n%q", got, want)
+	}
+
+	// The externals of a repo that isn't checked out aren't known, so they
+	// aren't reported as removed.
+	fresh.Externals[1].ExternalsKnown = false
+	if changes := DiffConfig(stored, fresh); len(changes) != 2 {
+		t.Errorf("changes are %v", changes)
+	}
+}
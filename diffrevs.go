@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Return the git diff arguments that diff the repo between svn revisions
+// revA and revB, with root relative paths. nil means the repo didn't change
+// between them.
+func diffRevsArgs(r *Repo, revA, revB string, extra []string) ([]string, error) {
+	commitA, err := sinceCommit(r.Path, revA)
+	if err != nil {
+		return nil, err
+	}
+	commitB, err := sinceCommit(r.Path, revB)
+	if err != nil {
+		return nil, err
+	}
+	if commitA == commitB {
+		return nil, nil
+	}
+	if commitA == "" {
+		commitA = emptyTree
+	}
+	if commitB == "" {
+		commitB = emptyTree
+	}
+
+	prefix := rootRelativePrefix(r)
+	args := []string{"diff", "--src-prefix=a/" + prefix, "--dst-prefix=b/" + prefix}
+	args = append(args, extra...)
+	return append(args, commitA, commitB), nil
+}
+
+// Diff all the repos between two svn revisions as one patch. Options before
+// the revisions are passed to git diff.
+func cmdDiffRevs(args []string, repo *Repo) error {
+	usage := func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish diff-revs [git diff options] <revA> <revB>\n")
+		fmt.Fprint(os.Stderr, "\tDiff the tree between svn revisions revA and revB, with paths relative to\n")
+		fmt.Fprint(os.Stderr, "\tthe root. Each repo's revisions are found with git svn find-rev, and repos\n")
+		fmt.Fprint(os.Stderr, "\tthat didn't change are left out. Repos that aren't git-svn are skipped.\n")
+	}
+	if len(args) < 3 {
+		return &UsageError{usage, "Need two svn revisions"}
+	}
+
+	extra := args[1 : len(args)-2]
+	var revs []string
+	for _, a := range args[len(args)-2:] {
+		m := svnRevRegex.FindStringSubmatch(a)
+		if m == nil {
+			return &UsageError{usage, fmt.Sprintf("Not an svn revision: %s", a)}
+		}
+		revs = append(revs, m[1])
+	}
+
+	var failed int
+	for _, r := range withSvnHistory(repo.Repos()) {
+		diffArgs, err := diffRevsArgs(r, revs[0], revs[1], extra)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed++
+			continue
+		}
+		if diffArgs == nil {
+			continue
+		}
+		err = execCmd(r.Path, "git", diffArgs...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "git diff failed in %s: %v\n", r.Path, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("The diff is missing %d repos", failed)
+	}
+	return nil
+}
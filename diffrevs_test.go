@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffRevsArgs(t *testing.T) {
+	root := diskTree(t)
+	b := &root.Externals[0]
+	// r100 predates the repo, r300 didn't change it.
+	fakeGit(t, `case "$4" in r200|r300) echo c200 ;; esac`)
+
+	args, err := diffRevsArgs(b, "100", "200", []string{"--stat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "diff --src-prefix=a/libs/b/ --dst-prefix=b/libs/b/ --stat " + emptyTree + " c200"
+	if got := strings.Join(args, " "); got != want {
+		t.Errorf("diff args are %q, want %q", got, want)
+	}
+
+	args, err = diffRevsArgs(b, "200", "300", nil)
+	if err != nil || args != nil {
+		t.Errorf("an unchanged repo gave %q, %v", args, err)
+	}
+
+	fakeGit(t, "exit 1")
+	if _, err := diffRevsArgs(b, "200", "300", nil); err == nil {
+		t.Error("a failing find-rev wasn't an error")
+	}
+}
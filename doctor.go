@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// A Problem is something wrong with the tree, with the action that fixes it.
+type Problem struct {
+	Desc string
+	Fix  func() error
+}
+
+// Check the tree for missing externals, externals missing from the ignore
+// file and a config that can't be read.
+func (repo *Repo) Diagnose() []Problem {
+	var problems []Problem
+
+	if b, err := fsys.ReadFile(repo.ConfigPath()); err == nil {
+		var stored Repo
+		if err := json.Unmarshal(b, &stored); err != nil {
+			problems = append(problems, Problem{
+				Desc: fmt.Sprintf("Config %s is corrupt: %v", repo.ConfigPath(), err),
+				Fix:  repo.WriteConfig,
+			})
+		}
+	}
+
+	return append(problems, repo.diagnoseExternals()...)
+}
+
+func (repo *Repo) diagnoseExternals() []Problem {
+	var problems []Problem
+
+	entries, err := repo.ignoreEntries()
+	if err != nil {
+		problems = append(problems, Problem{Desc: fmt.Sprintf("Can't read ignores of %s: %v", repo.Path, err)})
+	}
+	ignored := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		ignored[path.Clean(e)] = true
+	}
+
+	var unignored []string
+	for i := range repo.Externals {
+		ext := &repo.Externals[i]
+
+		if rel, err := filepath.Rel(repo.Path, ext.Path); err == nil && !ignored[rel] {
+			unignored = append(unignored, rel)
+		}
+
+		if !IsRepo(ext.Path) {
+			if repo.Root.Partial {
+				// Left out of the clone, sync fills it in.
+				continue
+			}
+			problems = append(problems, Problem{
+				Desc: fmt.Sprintf("External %s is missing", ext.Path),
+				Fix:  ext.Clone,
+			})
+			continue
+		}
+
+		problems = append(problems, ext.diagnoseExternals()...)
+	}
+
+	if len(unignored) > 0 {
+		problems = append(problems, Problem{
+			Desc: fmt.Sprintf("Externals of %s are not ignored: %s", repo.Path, strings.Join(unignored, ", ")),
+			Fix: func() error {
+				repo.IgnoreExternals()
+				return nil
+			},
+		})
+	}
+
+	return problems
+}
+
+func cmdDoctor(args []string, repo *Repo) error {
+	var fix, yes bool
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	flags.BoolVar(&fix, "fix", false, "Fix the problems found.")
+	flags.BoolVar(&yes, "yes", false, "Don't ask before fixing each problem.")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish doctor [options]\n")
+		fmt.Fprint(os.Stderr, "\tCheck for missing externals, missing ignores and a corrupt config.\n")
+		fmt.Fprint(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+
+	problems := repo.Diagnose()
+	remaining := 0
+	for _, p := range problems {
+		fmt.Println(p.Desc)
+		if !fix || p.Fix == nil {
+			remaining++
+			continue
+		}
+
+		if !yes && !confirm("Fix it?") {
+			remaining++
+			continue
+		}
+
+		if err := p.Fix(); err != nil {
+			fmt.Fprintln(os.Stderr, "Fix failed:", err)
+			remaining++
+			continue
+		}
+		fmt.Println("Fixed.")
+	}
+
+	if remaining > 0 {
+		return fmt.Errorf("%d problem(s) remain", remaining)
+	}
+	if len(problems) == 0 {
+		fmt.Println("No problems found.")
+	}
+	return nil
+}
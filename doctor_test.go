@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	useMemFS(t)
+	makeRepo(t, "/tree/root")
+	makeRepo(t, "/tree/root/libs/b")
+	root := testTree()
+	if err := fsys.WriteFile(root.ConfigPath(), []byte("{\"Path\": "), 0660); err != nil {
+		t.Fatal(err)
+	}
+
+	problems := root.Diagnose()
+	var descs []string
+	for _, p := range problems {
+		descs = append(descs, p.Desc)
+	}
+	all := strings.Join(descs, "\n")
+	for _, want := range []string{
+		"is corrupt",
+		"External /tree/root/libs/a is missing",
+		"Externals of /tree/root are not ignored: libs/b, libs/a",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("no problem mentions %q in\n%s", want, all)
+		}
+	}
+	if len(problems) != 3 {
+		t.Errorf("%d problems, want 3:\n%s", len(problems), all)
+	}
+
+	// Fix all but the missing external, which needs svn to clone.
+	for _, p := range problems {
+		if !strings.Contains(p.Desc, "missing") {
+			if err := p.Fix(); err != nil {
+				t.Fatalf("fixing %q: %v", p.Desc, err)
+			}
+		}
+	}
+	if problems := root.Diagnose(); len(problems) != 1 || !strings.Contains(problems[0].Desc, "missing") {
+		t.Errorf("after fixing, problems are %+v", problems)
+	}
+
+	root.Partial = true
+	if problems := root.Diagnose(); len(problems) != 0 {
+		t.Errorf("an external left out of a partial clone was reported: %+v", problems)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Lines starting with this in an edited config are comments, dropped
+// before it's parsed.
+const editCommentPrefix = "//"
+
+// Parse an edited config, checking it describes a tree that can be stored.
+func parseEditedConfig(b []byte, rootPath string) (*Repo, error) {
+	var kept []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), editCommentPrefix) {
+			kept = append(kept, line)
+		}
+	}
+
+	edited := new(Repo)
+	if err := json.Unmarshal([]byte(strings.Join(kept, "\n")), edited); err != nil {
+		return nil, err
+	}
+	if edited.Path != rootPath {
+		return nil, fmt.Errorf("the root path must stay %s", rootPath)
+	}
+	for _, r := range edited.Repos() {
+		if r.Url == "" {
+			return nil, fmt.Errorf("repo %s has no url", r.Path)
+		}
+	}
+	edited.LinkRoot()
+	if err := edited.CheckDuplicatePaths(); err != nil {
+		return nil, err
+	}
+	return edited, nil
+}
+
+// Run the user's editor on file.
+func runEditor(file string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// Through the shell, since the editor may come with arguments.
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, file)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Open the config in the user's editor and replace the tree with the
+// result. An edit that doesn't parse is opened again with the error at the
+// top, until it does or the file is emptied to give up.
+func (repo *Repo) EditConfig() error {
+	b, err := repo.MarshalConfig()
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile("", "gish-config-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+
+	for {
+		err = fsys.WriteFile(f.Name(), b, 0600)
+		if err != nil {
+			return err
+		}
+		err = runEditor(f.Name())
+		if err != nil {
+			return fmt.Errorf("Editor failed, config not changed: %v", err)
+		}
+		b, err = fsys.ReadFile(f.Name())
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(b)) == 0 {
+			return fmt.Errorf("Config emptied, not changed")
+		}
+
+		edited, perr := parseEditedConfig(b, repo.Path)
+		if perr == nil {
+			// The config is written with the edited tree when the command ends.
+			*repo = *edited
+			repo.LinkRoot()
+			// Externals removed in the editor are meant to go.
+			repo.shrinkOK = true
+			return nil
+		}
+
+		fmt.Fprintf(os.Stderr, "Invalid config: %v\n", perr)
+		var kept bytes.Buffer
+		fmt.Fprintf(&kept, "%s Invalid config: %v\n%s Fix it, or empty the file to give up.\n",
+			editCommentPrefix, perr, editCommentPrefix)
+		for _, line := range strings.SplitAfter(string(b), "\n") {
+			if !strings.HasPrefix(strings.TrimSpace(line), editCommentPrefix) {
+				kept.WriteString(line)
+			}
+		}
+		b = kept.Bytes()
+	}
+}
+
+// Report whether a config command line is meant for gish rather than git.
+func isGishConfig(args []string) bool {
+	return len(args) == 2 && (args[1] == "--edit" || args[1] == "--show")
+}
+
+// Show or edit the gish config. Other config invocations are passed to git.
+func cmdConfig(args []string, repo *Repo) error {
+	if !isGishConfig(args) {
+		return Foreach(repo.Repos(), args)
+	}
+	if args[1] == "--show" {
+		b, err := repo.MarshalConfig()
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+	return repo.EditConfig()
+}
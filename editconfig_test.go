@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseEditedConfig(t *testing.T) {
+	b, err := testTree().MarshalConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited, err := parseEditedConfig([]byte("// a comment\n"+string(b)), "/tree/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edited.Repos()) != 4 || edited.Externals[0].Root != edited {
+		t.Errorf("parsed %d repos", len(edited.Repos()))
+	}
+
+	for _, bad := range []string{
+		`{"Path": "/tree/root"`,
+		`{"Path": "/tree/moved", "Url": "u"}`,
+		`{"Path": "/tree/root", "Url": "u", "Externals": [{"Path": "/tree/root/a"}]}`,
+		`{"Path": "/tree/root", "Url": "u", "Externals": [{"Path": "/tree/root/a", "Url": "x"}, {"Path": "/tree/root/a", "Url": "y"}]}`,
+	} {
+		if _, err := parseEditedConfig([]byte(bad), "/tree/root"); err == nil {
+			t.Errorf("parsed %s", bad)
+		}
+	}
+}
+
+func TestEditConfig(t *testing.T) {
+	root := testTree()
+	dir := t.TempDir()
+	fixed := filepath.Join(dir, "fixed.json")
+	if err := os.WriteFile(fixed, []byte(`{"Path": "/tree/root", "Url": "https://svn.example.com/repo/trunk",
+		"Externals": [{"Path": "/tree/root/libs/c", "Url": "https://svn.example.com/repo/libs/c"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The first edit breaks the config, the second sees the error and fixes it.
+	editor := filepath.Join(dir, "editor")
+	script := "#!/bin/sh\nif [ -e " + dir + "/broke ]; then\n" +
+		"grep -q '^// Invalid config' \"$1\" && cp " + fixed + " \"$1\"\n" +
+		"else touch " + dir + "/broke; echo '{' > \"$1\"; fi\n"
+	if err := os.WriteFile(editor, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VISUAL", editor)
+
+	if err := root.EditConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if got := repoPaths(root.Repos()); !sameStrings(got, []string{"/tree/root", "/tree/root/libs/c"}) {
+		t.Errorf("edited tree is %q", got)
+	}
+	if !root.shrinkOK || root.Externals[0].Root != root {
+		t.Error("the edited tree can't be stored")
+	}
+
+	t.Setenv("VISUAL", "truncate -s 0")
+	if err := root.EditConfig(); err == nil || !strings.Contains(err.Error(), "emptied") {
+		t.Errorf("emptying the config returned %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+)
+
+// A setting gish resolved from its flags, environment and the tree.
+type setting struct {
+	Name, Value string
+}
+
+// Return the path a program is run from, "not found" if it isn't in PATH.
+func lookPath(name string) string {
+	p, err := exec.LookPath(name)
+	if err != nil {
+		return "not found"
+	}
+	return p
+}
+
+// Return the settings gish runs with in the current directory.
+func effectiveSettings() []setting {
+	settings := []setting{
+		{"git", lookPath("git")},
+		{"svn", lookPath("svn")},
+	}
+
+	rootPath, err := FindRootRepoPath()
+	if err != nil {
+		rootPath = ""
+	}
+	config := configFile
+	if config == "" && rootPath != "" {
+		config = configFilePath(rootPath)
+	}
+	_, err = fsys.Stat(config)
+	settings = append(settings,
+		setting{"root", rootPath},
+		setting{"config", config},
+		setting{"config-found", strconv.FormatBool(config != "" && err == nil)},
+	)
+	if rootPath != "" {
+		settings = append(settings,
+			setting{"manifest-dir", manifestDirOf(rootPath)},
+			setting{"hooks", hooksDir(rootPath)},
+			setting{"lock", path.Join(rootPath, lockRelPath)},
+		)
+	}
+
+	// Every global flag, so new ones are listed without touching this.
+	// -config is listed above as the file it resolves to.
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name != "config" {
+			settings = append(settings, setting{f.Name, f.Value.String()})
+		}
+	})
+	return append(settings, setting{"GISH_TRACE", os.Getenv("GISH_TRACE")})
+}
+
+func cmdEnv(args []string, _ *Repo) error {
+	var asJson bool
+	flags := flag.NewFlagSet("env", flag.ContinueOnError)
+	flags.BoolVar(&asJson, "json", false, "Print the settings as a JSON object.")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish env [options]\n")
+		fmt.Fprint(os.Stderr, "\tPrint the settings gish uses here, after flags and the environment.\n")
+		fmt.Fprint(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+
+	settings := effectiveSettings()
+	if asJson {
+		m := make(map[string]string, len(settings))
+		for _, s := range settings {
+			m[s.Name] = s.Value
+		}
+		b, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	for _, s := range settings {
+		fmt.Printf("%s=%s\n", s.Name, s.Value)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"path"
+	"testing"
+)
+
+func TestEffectiveSettings(t *testing.T) {
+	root := diskTree(t)
+	if err := root.WriteConfig(); err != nil {
+		t.Fatal(err)
+	}
+	fakeGit(t, "exit 1")
+	t.Setenv("GISH_TRACE", "1")
+	t.Chdir(root.Externals[1].Path)
+
+	got := make(map[string]string)
+	for _, s := range effectiveSettings() {
+		if _, dup := got[s.Name]; dup {
+			t.Errorf("%s is listed twice", s.Name)
+		}
+		got[s.Name] = s.Value
+	}
+	for name, want := range map[string]string{
+		"root":         root.Path,
+		"config":       path.Join(root.Path, cacheRelPath),
+		"config-found": "true",
+		"manifest-dir": "",
+		"hooks":        path.Join(root.Path, hooksRelPath),
+		"lock":         path.Join(root.Path, lockRelPath),
+		"GISH_TRACE":   "1",
+	} {
+		if v, ok := got[name]; !ok || v != want {
+			t.Errorf("%s=%q, want %q", name, v, want)
+		}
+	}
+
+	// Every global flag is listed, whichever flags are registered.
+	flag.VisitAll(func(f *flag.Flag) {
+		if _, ok := got[f.Name]; !ok {
+			t.Errorf("flag -%s isn't listed", f.Name)
+		}
+	})
+}
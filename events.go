@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+var eventsDest string // Where -events-json writes, "" for nowhere
+
+// An Event is one JSON line of -events-json output.
+type Event struct {
+	Event    string   `json:"event"` // start, finish or error
+	Time     string   `json:"time"`
+	Repo     string   `json:"repo"`
+	Command  []string `json:"command,omitempty"`
+	ExitCode *int     `json:"exit_code,omitempty"` // finish only
+	Duration float64  `json:"duration,omitempty"`  // Seconds, finish only
+	Error    string   `json:"error,omitempty"`
+}
+
+var events struct {
+	sync.Mutex
+	enc *json.Encoder // nil if events are off
+}
+
+// Open the -events-json destination, "-" for stdout.
+func openEvents(dest string) error {
+	if dest == "" {
+		return nil
+	}
+	var w io.Writer = os.Stdout
+	if dest != "-" {
+		f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("Can't open events file: %v", err)
+		}
+		w = f
+	}
+	events.enc = json.NewEncoder(w)
+	return nil
+}
+
+func emit(e Event) {
+	events.Lock()
+	defer events.Unlock()
+	if events.enc == nil {
+		return
+	}
+	e.Time = time.Now().Format(time.RFC3339Nano)
+	events.enc.Encode(e)
+}
+
+// Emit the start of a command in a repo. The returned func emits its finish,
+// and an error event if err isn't nil.
+func emitStart(repoPath string, command []string) (finish func(err error)) {
+	if eventsDest == "" {
+		return func(error) {}
+	}
+	start := time.Now()
+	emit(Event{Event: "start", Repo: repoPath, Command: command})
+	return func(err error) {
+		code := exitCode(err)
+		emit(Event{Event: "finish", Repo: repoPath, Command: command, ExitCode: &code,
+			Duration: time.Since(start).Seconds()})
+		if err != nil {
+			emit(Event{Event: "error", Repo: repoPath, Command: command, Error: err.Error()})
+		}
+	}
+}
+
+// Return the exit status of a command's error, 0 for success and -1 when
+// the command didn't exit normally.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEvents(t *testing.T) {
+	root := diskTree(t)
+	fakeGit(t, `case "$PWD" in */libs/b) exit 3;; esac`)
+	eventsDest = filepath.Join(t.TempDir(), "events.json")
+	if err := openEvents(eventsDest); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		eventsDest = ""
+		events.enc = nil
+	}()
+
+	captureStdout(t, func() { Foreach(root.Repos(), []string{"fetch"}) })
+
+	f, err := os.Open(eventsDest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	counts := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("%q isn't an event: %v", scanner.Text(), err)
+		}
+		counts[e.Event]++
+		if e.Time == "" || e.Repo == "" || strings.Join(e.Command, " ") != "git fetch" {
+			t.Errorf("incomplete event %+v", e)
+		}
+		if e.Event == "finish" {
+			want := 0
+			if e.Repo == root.Externals[0].Path {
+				want = 3
+			}
+			if e.ExitCode == nil || *e.ExitCode != want {
+				t.Errorf("%s finished with %v, want %d", e.Repo, e.ExitCode, want)
+			}
+		}
+		if e.Event == "error" && (e.Repo != root.Externals[0].Path || e.Error == "") {
+			t.Errorf("unexpected error event %+v", e)
+		}
+	}
+	if counts["start"] != 4 || counts["finish"] != 4 || counts["error"] != 1 {
+		t.Errorf("event counts %v", counts)
+	}
+}
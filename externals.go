@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Report whether the repo is a git-svn checkout, as opposed to a plain git
+// repo such as a mirror of one.
+func isGitSvn(repoPath string) bool {
+	return IsDir(path.Join(gitCommonDir(repoPath), "svn"))
+}
+
+// Get svn info for an svn url from the server. Label is as for GitSvnInfo.
+func SvnInfo(svnUrl, label string) (string, error) {
+	out, err := execCmdEnv("", cLocale, "svn", "info", svnUrl)
+	if err != nil {
+		return "", fmt.Errorf("svn info %s failed (%s)", svnUrl, err)
+	}
+
+	if value, ok := infoField(out, label); ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("attribute %s not found in svn info", label)
+}
+
+// Return the root url of the svn repository the repo was cloned from.
+func (repo *Repo) repositoryRoot() (string, error) {
+	if isGitSvn(repo.Path) {
+		return GitSvnInfo(repo.Path, "Repository Root")
+	}
+	return SvnInfo(repo.Url, "Repository Root")
+}
+
+// Svn revision to read the root's externals at, "" for HEAD. Externals of
+// externals may be in other svn repositories, so they're always read at HEAD.
+var externalsRev string // clone, list
+
+// Read the raw externals of the repo, in 'git svn show-externals' format.
+// git-svn checkouts are asked directly, other repos fall back to reading the
+// svn:externals properties from the server.
+func (repo *Repo) rawExternals() (string, error) {
+	var revArgs []string
+	if externalsRev != "" && repo.Root == repo {
+		revArgs = []string{"-r", externalsRev}
+	}
+
+	if isGitSvn(repo.Path) {
+		args := append([]string{"svn", "show-externals"}, revArgs...)
+		out, err := execCmdCombinedOutput(repo.Path, "git", args...)
+		if err != nil {
+			return "", fmt.Errorf("git svn show-externals failed in %s: %v", repo.Path, err)
+		}
+		return string(out), nil
+	}
+
+	if repo.Url == "" {
+		return "", fmt.Errorf("%s is not a git-svn repo and has no svn url to read externals from", repo.Path)
+	}
+
+	args := append([]string{"propget", "-R"}, revArgs...)
+	out, err := execCmdCombinedOutput(repo.Path, "svn", append(args, "svn:externals", repo.Url)...)
+	if err != nil {
+		return "", fmt.Errorf("svn propget failed for %s: %v", repo.Url, err)
+	}
+	return propgetToShowExternals(repo.Url, string(out)), nil
+}
+
+// Convert the output of 'svn propget -R svn:externals <baseUrl>' to the
+// format of 'git svn show-externals'. propget prints each directory's
+// property as "<dirUrl> - <first line>", followed by the remaining lines and
+// a blank line. show-externals prints a "# <dir>" header and then each line
+// prefixed with the directory, relative to the base url.
+func propgetToShowExternals(baseUrl, raw string) string {
+	baseUrl = strings.TrimSuffix(baseUrl, "/")
+
+	var out strings.Builder
+	var dir string
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			dir = ""
+			continue
+		}
+
+		if dir == "" {
+			i := strings.Index(line, " - ")
+			if i < 0 || !strings.HasPrefix(line[:i], baseUrl) {
+				continue
+			}
+			dir = "/"
+			if rel := strings.Trim(strings.TrimPrefix(line[:i], baseUrl), "/"); rel != "" {
+				dir += rel + "/"
+			}
+			fmt.Fprintf(&out, "# %s\n", dir)
+			line = line[i+3:]
+		}
+
+		fmt.Fprintf(&out, "%s%s\n", dir, strings.TrimSpace(line))
+	}
+	return out.String()
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPropgetToShowExternals(t *testing.T) {
+	raw := "https://svn.example.com/repo/trunk - ^/libs/a lib/a\n" +
+		"-r12 ^/libs/b lib/b\n" +
+		"\n" +
+		"https://svn.example.com/repo/trunk/src/ui - ../../widgets@7 widgets\n" +
+		"\n" +
+		"https://svn.example.com/elsewhere - ^/x x\n"
+	want := "# /\n" +
+		"/^/libs/a lib/a\n" +
+		"/-r12 ^/libs/b lib/b\n" +
+		"# /src/ui/\n" +
+		"/src/ui/../../widgets@7 widgets\n"
+	if got := propgetToShowExternals("https://svn.example.com/repo/trunk/", raw); got != want {
+		t.Errorf("converted to\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCookPropgetExternals(t *testing.T) {
+	root := cookRoot(t)
+	raw := propgetToShowExternals(root.Url, "https://svn.example.com/repo/trunk/src - ../libs/a a\n")
+	if err := root.CookExternals(raw); err != nil {
+		t.Fatal(err)
+	}
+	if len(root.Externals) != 1 || root.Externals[0].Path != "/tree/root/src/a" ||
+		root.Externals[0].Url != "https://svn.example.com/repo/trunk/libs/a" {
+		t.Errorf("cooked %+v", root.Externals)
+	}
+}
+
+// Put a command on PATH that runs script, for commands whose output is all
+// a test needs.
+func fakeCommand(t *testing.T, name, script string) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func fakeGit(t *testing.T, script string) {
+	fakeCommand(t, "git", script)
+}
+
+func TestLoadExternalsNone(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ".git", "svn"), 0770); err != nil {
+		t.Fatal(err)
+	}
+	repo := &Repo{Path: dir, Url: "https://svn.example.com/repo/trunk"}
+	repo.LinkRoot()
+
+	fakeGit(t, "exit 0")
+	if err := repo.LoadExternals(); err != nil {
+		t.Errorf("a repo without externals: %v", err)
+	}
+	if len(repo.Externals) != 0 || !repo.ExternalsKnown {
+		t.Errorf("loaded %+v, known %v", repo.Externals, repo.ExternalsKnown)
+	}
+
+	fakeGit(t, "echo 'Unable to determine upstream SVN information' >&2; exit 1")
+	if err := repo.LoadExternals(); err == nil {
+		t.Error("failing to read the externals wasn't an error")
+	}
+}
+
+func TestCookNestedExternalsRoot(t *testing.T) {
+	useMemFS(t)
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho x >> " + calls + "\n" +
+		"case \"$2\" in svn://other.example.com/*) echo 'Repository Root: svn://other.example.com';;\n" +
+		"*) echo 'Repository Root: https://svn.example.com/repo';; esac\n"
+	if err := os.WriteFile(filepath.Join(dir, "svn"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	root := &Repo{Path: "/tree/root", Url: "https://svn.example.com/repo/trunk"}
+	root.LinkRoot()
+	if err := root.CookExternals("# /\n/svn://other.example.com/a/trunk a\n/^/libs/b b\n/^/libs/c c\n"); err != nil {
+		t.Fatal(err)
+	}
+	root.LinkRoot()
+	a := &root.Externals[0]
+	if err := a.CookExternals("# /\n/^/inner inner\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.Externals[0].Url; got != "svn://other.example.com/inner" {
+		t.Errorf("^/ in an external of an external resolved to %s", got)
+	}
+	if got := root.Externals[2].Url; got != "https://svn.example.com/repo/libs/c" {
+		t.Errorf("^/ in the root resolved to %s", got)
+	}
+
+	// svn info runs once for each repo whose externals were cooked.
+	b, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(b) / 2; n != 2 {
+		t.Errorf("svn info ran %d times, want 2", n)
+	}
+}
+
+func TestSvnInfoLocale(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$LC_ALL\" = C ]; then echo 'Repository Root: https://svn.example.com/repo'\n" +
+		"else echo 'Racine du dépôt : https://svn.example.com/repo'; fi\n"
+	if err := os.WriteFile(filepath.Join(dir, "svn"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("LC_ALL", "fr_FR.UTF-8")
+
+	got, err := SvnInfo("https://svn.example.com/repo/trunk", "Repository Root")
+	if err != nil || got != "https://svn.example.com/repo" {
+		t.Errorf("svn info in a french locale gave %q, %v", got, err)
+	}
+	if _, err := SvnInfo("https://svn.example.com/repo/trunk", "UUID"); err == nil {
+		t.Error("found a field svn info doesn't print")
+	}
+}
+
+func TestInfoField(t *testing.T) {
+	out := []byte("Path: trunk\nURL: https://svn.example.com/repo/trunk\nRepository Root:  https://svn.example.com/repo \nEmpty:\n")
+	for label, want := range map[string]string{
+		"URL":             "https://svn.example.com/repo/trunk",
+		"Repository Root": "https://svn.example.com/repo",
+		"Empty":           "",
+	} {
+		if got, ok := infoField(out, label); !ok || got != want {
+			t.Errorf("%s is %q, %v", label, got, ok)
+		}
+	}
+	for _, label := range []string{"Repository", "Path: trunk", "Revision"} {
+		if _, ok := infoField(out, label); ok {
+			t.Errorf("found %s", label)
+		}
+	}
+}
+
+func TestExternalsRev(t *testing.T) {
+	dir := t.TempDir()
+	root := &Repo{Path: dir, Url: "https://svn.example.com/repo/trunk"}
+	root.LinkRoot()
+	ext := &Repo{Path: filepath.Join(dir, "lib"), Url: "https://svn.example.com/repo/lib", Root: root}
+	for _, r := range []*Repo{root, ext} {
+		if err := os.MkdirAll(filepath.Join(r.Path, ".git", "svn"), 0770); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() { externalsRev = "" }()
+	externalsRev = "120"
+
+	fakeGit(t, `echo "$*"`)
+	for _, c := range []struct {
+		repo *Repo
+		want string
+	}{
+		{root, "svn show-externals -r 120\n"},
+		{ext, "svn show-externals\n"},
+	} {
+		got, err := c.repo.rawExternals()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("%s ran git %q, want %q", c.repo.Path, got, c.want)
+		}
+	}
+
+	svnRoot := &Repo{Path: t.TempDir(), Url: root.Url}
+	svnRoot.LinkRoot()
+	logFile := filepath.Join(t.TempDir(), "log")
+	fakeCommand(t, "svn", `echo "$*" > `+logFile)
+	if _, err := svnRoot.rawExternals(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "propget -R -r 120 svn:externals " + root.Url + "\n"; string(got) != want {
+		t.Errorf("ran svn %q, want %q", got, want)
+	}
+}
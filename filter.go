@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// globFlag collects repeated glob flags.
+type globFlag []string
+
+func (g *globFlag) String() string {
+	return strings.Join(*g, " ")
+}
+
+func (g *globFlag) Set(s string) error {
+	if _, err := path.Match(s, ""); err != nil {
+		return fmt.Errorf("bad pattern %q: %v", s, err)
+	}
+	*g = append(*g, s)
+	return nil
+}
+
+var (
+	cloneFilters globFlag // clone -filter
+	noExternals  bool     // clone -no-externals
+	filteredOut  int      // Externals the clone filters skipped
+)
+
+// Report whether the clone filters select an external. An external is
+// selected when its root relative path, or a directory above it, matches one
+// of the filters. With no filters every external is selected, and with
+// -no-externals none are.
+func cloneSelected(ext *Repo) bool {
+	if noExternals {
+		return false
+	}
+	if len(cloneFilters) == 0 {
+		return true
+	}
+	rel, err := filepath.Rel(ext.Root.Path, ext.Path)
+	if err != nil {
+		return true
+	}
+
+	p := ""
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		p = path.Join(p, part)
+		for _, glob := range cloneFilters {
+			if ok, _ := path.Match(glob, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Select the repos that are checked out, for trees from a partial clone.
+func presentOnly(repos []*Repo) []*Repo {
+	var present []*Repo
+	for _, r := range repos {
+		if IsRepo(r.Path) {
+			present = append(present, r)
+		}
+	}
+	return present
+}
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestCloneSelected(t *testing.T) {
+	root := testTree()
+	b, a := &root.Externals[0], &root.Externals[1]
+	inner := &a.Externals[0]
+	defer func() { cloneFilters = nil }()
+
+	for _, c := range []struct {
+		filters []string
+		want    []*Repo
+	}{
+		{nil, []*Repo{b, a, inner}},
+		{[]string{"libs/a"}, []*Repo{a, inner}},
+		{[]string{"libs/*"}, []*Repo{b, a, inner}},
+		{[]string{"libs/a/inner"}, []*Repo{inner}},
+		{[]string{"libs/b", "*/a/inner"}, []*Repo{b, inner}},
+		{[]string{"lib"}, nil},
+	} {
+		cloneFilters = nil
+		for _, f := range c.filters {
+			if err := cloneFilters.Set(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var got []*Repo
+		for _, r := range []*Repo{b, a, inner} {
+			if cloneSelected(r) {
+				got = append(got, r)
+			}
+		}
+		if !sameStrings(repoPaths(got), repoPaths(c.want)) {
+			t.Errorf("-filter %q selected %q", c.filters, repoPaths(got))
+		}
+	}
+
+	if err := cloneFilters.Set("libs/["); err == nil {
+		t.Error("a bad glob was accepted")
+	}
+}
+
+func TestPresentOnly(t *testing.T) {
+	useMemFS(t)
+	makeRepo(t, "/tree/root")
+	makeRepo(t, "/tree/root/libs/a/inner")
+	got := repoPaths(presentOnly(testTree().Repos()))
+	if want := []string{"/tree/root", "/tree/root/libs/a/inner"}; !sameStrings(got, want) {
+		t.Errorf("present repos %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"sync"
+)
+
+var (
+	jobs          = 1  // Number of repos commands run in at once
+	jobsPerServer int  // Limit of concurrent commands per svn server, 0 for no limit
+	noHeaders     bool // Omit the header line naming each repo
+	maxErrors     int  // Stop after this many repos fail, 0 for no limit
+
+	onError       = onErrorContinue // foreach -on-error
+	chdirRelative string            // foreach -chdir-relative
+)
+
+// What foreach does after git fails in a repo.
+const (
+	onErrorContinue = "continue" // Run in the rest of the repos
+	onErrorStop     = "stop"     // Skip the rest of the repos
+	onErrorPrompt   = "prompt"   // Ask whether to run in the rest
+)
+
+// Report whether foreach should go on to the next repo after git failed in r.
+func continueAfterError(r *Repo) bool {
+	switch onError {
+	case onErrorStop:
+		return false
+	case onErrorPrompt:
+		return confirm(fmt.Sprintf("Git failed in %s. Continue with the other repos?", r.Path))
+	}
+	return true
+}
+
+// Report whether -max-errors has been reached.
+func tooManyErrors(failed int) bool {
+	return maxErrors > 0 && failed >= maxErrors
+}
+
+func tooManyErrorsError(failed, skipped int) error {
+	return fmt.Errorf("Stopped after git failed in %d repos, %d repos weren't run", failed, skipped)
+}
+
+// A RepoFilter narrows the list of repos a command is run on.
+// The list is in Repo.Paths order, so the root repo comes first.
+type RepoFilter func(repos []*Repo) []*Repo
+
+// Select only the root repo.
+func rootOnly(repos []*Repo) []*Repo {
+	if len(repos) == 0 {
+		return repos
+	}
+	return repos[:1]
+}
+
+// Select everything but the root repo.
+func externalsOnly(repos []*Repo) []*Repo {
+	if len(repos) == 0 {
+		return repos
+	}
+	return repos[1:]
+}
+
+// Select the repos with local changes.
+func dirtyOnly(repos []*Repo) []*Repo {
+	var dirty []*Repo
+	for _, r := range repos {
+		state, err := r.Status()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Skipping repo:", err)
+			continue
+		}
+		if state == stateDirty {
+			dirty = append(dirty, r)
+		}
+	}
+	return dirty
+}
+
+// Put the selected repos in post order, with each repo's externals before
+// it and the root last. Filters that pick out the root must come first.
+func postOrder(tree *Repo) RepoFilter {
+	return func(repos []*Repo) []*Repo {
+		selected := make(map[*Repo]bool, len(repos))
+		for _, r := range repos {
+			selected[r] = true
+		}
+		var ordered []*Repo
+		for _, r := range tree.ReposPostOrder() {
+			if selected[r] {
+				ordered = append(ordered, r)
+			}
+		}
+		return ordered
+	}
+}
+
+// Return the directory git runs in for the repo, its -chdir-relative
+// subdirectory if one is given.
+func foreachDir(r *Repo) string {
+	return path.Join(r.Path, chdirRelative)
+}
+
+// Select the repos that have the -chdir-relative subdirectory, noting those
+// skipped.
+func withSubdir(repos []*Repo) []*Repo {
+	var selected []*Repo
+	for _, r := range repos {
+		if !IsDir(foreachDir(r)) {
+			fmt.Printf("Repo %s: no %s, skipping.\n", r.Label(), chdirRelative)
+			continue
+		}
+		selected = append(selected, r)
+	}
+	return selected
+}
+
+// Apply the filters to repos in order.
+func FilterRepos(repos []*Repo, filters ...RepoFilter) []*Repo {
+	for _, f := range filters {
+		repos = f(repos)
+	}
+	return repos
+}
+
+// Execute git with args in each of the repos.
+// With jobs > 1 the repos are run concurrently and each repo's output is
+// printed once its command finishes.
+// A rebase that stops on a conflict halts the remaining repos, and the
+// conflicted repos are returned in a RebaseConflictError. The remaining repos
+// are also skipped once -max-errors repos have failed. git svn commands
+// aren't run in plain git repos, and externals left out of a partial clone
+// are skipped.
+func Foreach(repos []*Repo, args []string) error {
+	_, err := ForeachFailed(repos, args)
+	return err
+}
+
+// Like Foreach, but also return the repos git failed in, for commands whose
+// next step depends on the first.
+func ForeachFailed(repos []*Repo, args []string) (failedRepos []*Repo, err error) {
+	if len(repos) > 0 && repos[0].Root != nil && repos[0].Root.Partial {
+		repos = presentOnly(repos)
+	}
+	if len(args) > 0 && args[0] == "svn" {
+		repos = gitSvnOnly(repos)
+	}
+	rebasing := isRebaseCommand(args)
+	if jobs > 1 {
+		return foreachParallel(repos, args, rebasing, newThrottle(jobs, jobsPerServer))
+	}
+
+	for i, r := range repos {
+		printHeader(r)
+		var out bytes.Buffer
+		cmd := newCmd(foreachDir(r), nil, "git", args...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if rebasing {
+			// Keep a copy of the output to look for conflicts.
+			cmd.Stdout = io.MultiWriter(os.Stdout, &out)
+			cmd.Stderr = io.MultiWriter(os.Stderr, &out)
+		}
+		logDone := teeCmdToLog(cmd)
+		finish := emitStart(r.Path, cmd.Args)
+		err := cmd.Run()
+		logDone(err)
+		finish(err)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Git returned error:", err)
+			// Don't quit, commands that get paged will return error.
+			failedRepos = append(failedRepos, r)
+			if rebasing && rebaseConflicted(r.Path, out.Bytes()) {
+				return failedRepos, &RebaseConflictError{[]string{r.Path}}
+			}
+			if tooManyErrors(len(failedRepos)) {
+				return failedRepos, tooManyErrorsError(len(failedRepos), len(repos)-i-1)
+			}
+			if !continueAfterError(r) {
+				return failedRepos, fmt.Errorf("Stopped after git failed in %s, %d repos weren't run", r.Path, len(repos)-i-1)
+			}
+		}
+	}
+	return failedRepos, nil
+}
+
+// Print the line that introduces a repo's output, unless headers are off.
+func printHeader(r *Repo) {
+	if !noHeaders {
+		fmt.Printf("Repo %s:\n", r.Label())
+	}
+}
+
+func foreachParallel(repos []*Repo, args []string, rebasing bool, t *throttle) ([]*Repo, error) {
+	var wg sync.WaitGroup
+	var outputMu sync.Mutex
+	var conflicted []string
+	var failedRepos []*Repo
+	var skipped int
+	for _, r := range repos {
+		wg.Add(1)
+		go func(r *Repo) {
+			defer wg.Done()
+
+			release := t.acquire(r)
+			outputMu.Lock()
+			failed := len(failedRepos)
+			halted := len(conflicted) > 0 || tooManyErrors(failed) || (onError == onErrorStop && failed > 0)
+			if halted {
+				skipped++
+			}
+			outputMu.Unlock()
+			if halted {
+				// Repos already running finish, but no more are started.
+				release()
+				return
+			}
+			finish := emitStart(r.Path, append([]string{"git"}, args...))
+			out, err := execCmdCapture(foreachDir(r), "git", args...)
+			release()
+			finish(err)
+
+			outputMu.Lock()
+			defer outputMu.Unlock()
+			printHeader(r)
+			os.Stdout.Write(out)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Git returned error:", err)
+				if rebasing && rebaseConflicted(r.Path, out) {
+					conflicted = append(conflicted, r.Path)
+				}
+				failedRepos = append(failedRepos, r)
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	if len(conflicted) > 0 {
+		sort.Strings(conflicted)
+		return failedRepos, &RebaseConflictError{conflicted}
+	}
+	if failed := len(failedRepos); tooManyErrors(failed) || (onError == onErrorStop && failed > 0) {
+		return failedRepos, tooManyErrorsError(failed, skipped)
+	}
+	return failedRepos, nil
+}
+
+// A throttle limits how many commands run at once, overall and per svn server.
+type throttle struct {
+	all     chan struct{}
+	perHost int
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+func newThrottle(jobs, perHost int) *throttle {
+	if jobs < 1 {
+		jobs = 1
+	}
+	return &throttle{
+		all:     make(chan struct{}, jobs),
+		perHost: perHost,
+		hosts:   make(map[string]chan struct{}),
+	}
+}
+
+// Wait until a command may run in the repo. The returned func ends the command.
+func (t *throttle) acquire(r *Repo) (release func()) {
+	// Take the server slot first so waiting on a busy server doesn't hold
+	// up repos on other servers.
+	var host chan struct{}
+	if t.perHost > 0 {
+		root := serverRoot(r.Url)
+		t.mu.Lock()
+		host = t.hosts[root]
+		if host == nil {
+			host = make(chan struct{}, t.perHost)
+			t.hosts[root] = host
+		}
+		t.mu.Unlock()
+		host <- struct{}{}
+	}
+	t.all <- struct{}{}
+
+	return func() {
+		<-t.all
+		if host != nil {
+			<-host
+		}
+	}
+}
+
+func cmdForeach(args []string, repo *Repo) error {
+	var rootOnlyFlag, externalsOnlyFlag, dirtyOnlyFlag, reverse bool
+	flags := flag.NewFlagSet("foreach", flag.ContinueOnError)
+	flags.BoolVar(&rootOnlyFlag, "root-only", false, "Run only in the root repo.")
+	flags.BoolVar(&externalsOnlyFlag, "externals-only", false, "Run in every repo except the root.")
+	flags.BoolVar(&dirtyOnlyFlag, "dirty-only", false, "Run only in repos with local changes.")
+	flags.BoolVar(&reverse, "reverse", false, "Run in each repo's externals before the repo, and the root last.")
+	flags.StringVar(&chdirRelative, "chdir-relative", "", "Run in this subdirectory of each repo, skipping repos without it.")
+	flags.StringVar(&onError, "on-error", onErrorContinue, "After git fails in a repo: continue, stop, or prompt whether to continue.")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish foreach [options] <git command> [args]\n")
+		fmt.Fprint(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+
+	if len(args) < 2 {
+		return &UsageError{flags.Usage, "Not enough arguments to 'gish foreach'."}
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+
+	if rootOnlyFlag && externalsOnlyFlag {
+		return &UsageError{flags.Usage, "-root-only and -externals-only are mutually exclusive."}
+	}
+
+	switch onError {
+	case onErrorContinue, onErrorStop:
+	case onErrorPrompt:
+		if jobs > 1 {
+			return &UsageError{flags.Usage, "-on-error=prompt can't be used with -j."}
+		}
+	default:
+		return &UsageError{flags.Usage, fmt.Sprintf("-on-error must be continue, stop or prompt, not %q.", onError)}
+	}
+
+	gitArgs := flags.Args()
+	if len(gitArgs) == 0 {
+		return &UsageError{flags.Usage, "No git command provided."}
+	}
+
+	var filters []RepoFilter
+	if rootOnlyFlag {
+		filters = append(filters, rootOnly)
+	}
+	if externalsOnlyFlag {
+		filters = append(filters, externalsOnly)
+	}
+	if dirtyOnlyFlag {
+		// Last, so git status only runs in the repos the other filters selected.
+		filters = append(filters, dirtyOnly)
+	}
+	if chdirRelative != "" {
+		if err := checkRemapPath(chdirRelative); err != nil {
+			return &UsageError{flags.Usage, "-chdir-relative " + err.Error()}
+		}
+		filters = append(filters, withSubdir)
+	}
+	if reverse {
+		filters = append(filters, postOrder(repo))
+	}
+
+	return Foreach(FilterRepos(repo.Repos(), filters...), gitArgs)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Return the paths of repos, to compare selections.
+func repoPaths(repos []*Repo) []string {
+	var paths []string
+	for _, r := range repos {
+		paths = append(paths, r.Path)
+	}
+	return paths
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRootAndExternalsOnly(t *testing.T) {
+	repos := testTree().Repos()
+	if got := repoPaths(FilterRepos(repos, rootOnly)); !sameStrings(got, []string{"/tree/root"}) {
+		t.Errorf("root only selected %q", got)
+	}
+	want := []string{"/tree/root/libs/b", "/tree/root/libs/a", "/tree/root/libs/a/inner"}
+	if got := repoPaths(FilterRepos(repos, externalsOnly)); !sameStrings(got, want) {
+		t.Errorf("externals only selected %q, want %q", got, want)
+	}
+	if got := FilterRepos(nil, rootOnly, externalsOnly); len(got) != 0 {
+		t.Errorf("selected %d repos from none", len(got))
+	}
+}
+
+func TestDirtyOnly(t *testing.T) {
+	useMemFS(t)
+	statusCache.Lock()
+	statusCache.states["/tree/root"] = stateClean
+	statusCache.states["/tree/root/libs/b"] = stateDirty
+	statusCache.states["/tree/root/libs/a/inner"] = stateDirty
+	statusCache.Unlock()
+	defer func() {
+		statusCache.Lock()
+		statusCache.states = make(map[string]string)
+		statusCache.Unlock()
+	}()
+
+	// libs/a isn't cloned and is skipped as missing, not dirty.
+	repos := testTree().Repos()
+	want := []string{"/tree/root/libs/b", "/tree/root/libs/a/inner"}
+	if got := repoPaths(FilterRepos(repos, dirtyOnly)); !sameStrings(got, want) {
+		t.Errorf("dirty only selected %q, want %q", got, want)
+	}
+	if got := repoPaths(FilterRepos(repos, rootOnly, dirtyOnly)); len(got) != 0 {
+		t.Errorf("the clean root was selected: %q", got)
+	}
+}
+
+func TestMaxErrors(t *testing.T) {
+	root := diskTree(t)
+	fakeGit(t, "echo failing; exit 1")
+	maxErrors = 2
+	defer func() { maxErrors = 0; jobs = 1 }()
+
+	var failed []*Repo
+	var err error
+	out := captureStdout(t, func() { failed, err = ForeachFailed(root.Repos(), []string{"fetch"}) })
+	if err == nil || !strings.Contains(err.Error(), "failed in 2 repos, 2 repos weren't run") {
+		t.Errorf("returned %v", err)
+	}
+	if len(failed) != 2 || strings.Count(out, "failing") != 2 {
+		t.Errorf("ran after the second failure:\n%s", out)
+	}
+
+	jobs = 4
+	captureStdout(t, func() { failed, err = ForeachFailed(root.Repos(), []string{"fetch"}) })
+	if err == nil || len(failed) < 2 {
+		t.Errorf("-j 4 returned %v after %d failures", err, len(failed))
+	}
+
+	maxErrors = 0
+	jobs = 1
+	captureStdout(t, func() { failed, err = ForeachFailed(root.Repos(), []string{"fetch"}) })
+	if err != nil || len(failed) != 4 {
+		t.Errorf("without a limit returned %v after %d failures", err, len(failed))
+	}
+}
+
+func TestOnError(t *testing.T) {
+	root := diskTree(t)
+	fakeGit(t, "echo failing; exit 1")
+	defer func() { onError = onErrorContinue; stdinReader = bufio.NewReader(os.Stdin) }()
+
+	var failed []*Repo
+	var err error
+	onError = onErrorStop
+	out := captureStdout(t, func() { failed, err = ForeachFailed(root.Repos(), []string{"fetch"}) })
+	if err == nil || !strings.Contains(err.Error(), "3 repos weren't run") || strings.Count(out, "failing") != 1 {
+		t.Errorf("-on-error=stop returned %v after:\n%s", err, out)
+	}
+
+	// Continue after the first failure, stop after the second.
+	onError = onErrorPrompt
+	stdinReader = bufio.NewReader(strings.NewReader("y\nn\n"))
+	out = captureStdout(t, func() { failed, err = ForeachFailed(root.Repos(), []string{"fetch"}) })
+	if err == nil || len(failed) != 2 || strings.Count(out, "Continue with the other repos?") != 2 {
+		t.Errorf("-on-error=prompt returned %v after:\n%s", err, out)
+	}
+
+	onError = onErrorContinue
+	captureStdout(t, func() { failed, err = ForeachFailed(root.Repos(), []string{"fetch"}) })
+	if err != nil || len(failed) != 4 {
+		t.Errorf("-on-error=continue returned %v after %d failures", err, len(failed))
+	}
+}
+
+func TestThrottlePerServer(t *testing.T) {
+	th := newThrottle(4, 1)
+	var mu sync.Mutex
+	running := make(map[string]int)
+	peak := make(map[string]int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 12; i++ {
+		r := &Repo{Url: "https://a.example.com/repo"}
+		if i%2 == 1 {
+			r.Url = "svn://b.example.com/repo"
+		}
+		wg.Add(1)
+		go func(r *Repo) {
+			defer wg.Done()
+			release := th.acquire(r)
+			host := serverRoot(r.Url)
+			mu.Lock()
+			running[host]++
+			if running[host] > peak[host] {
+				peak[host] = running[host]
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			running[host]--
+			mu.Unlock()
+			release()
+		}(r)
+	}
+	wg.Wait()
+
+	for host, n := range peak {
+		if n != 1 {
+			t.Errorf("%d commands ran at once on %s, want 1", n, host)
+		}
+	}
+}
+
+// Return testTree with its repos created in a temporary directory, for
+// running commands in them.
+func diskTree(t *testing.T) *Repo {
+	root := testTree()
+	RewritePaths(root, "/tree/root", t.TempDir())
+	for _, r := range root.Repos() {
+		if err := os.MkdirAll(filepath.Join(r.Path, ".git", "info"), 0770); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// Return what f writes to stdout.
+func captureStdout(t *testing.T, f func()) string {
+	return captureOutput(t, &os.Stdout, f)
+}
+
+// Run f with *out redirected to a pipe, return what f wrote to it.
+func captureOutput(t *testing.T, out **os.File, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := *out
+	*out = w
+	done := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- string(b)
+	}()
+	defer func() {
+		*out = saved
+	}()
+	f()
+	w.Close()
+	return <-done
+}
+
+func TestNoHeaders(t *testing.T) {
+	root := diskTree(t)
+	fakeGit(t, "echo output")
+	defer func() { jobs = 1 }()
+	for _, j := range []int{1, 4} {
+		jobs = j
+		out := captureStdout(t, func() { Foreach(root.Repos(), []string{"log"}) })
+		if n := strings.Count(out, "Repo "); n != 4 || strings.Count(out, "output\n") != 4 {
+			t.Errorf("-j %d: %d headers in\n%s", j, n, out)
+		}
+
+		noHeaders = true
+		out = captureStdout(t, func() { Foreach(root.Repos(), []string{"log"}) })
+		noHeaders = false
+		if out != strings.Repeat("output\n", 4) {
+			t.Errorf("-j %d -no-headers printed\n%s", j, out)
+		}
+	}
+}
+
+func TestPostOrder(t *testing.T) {
+	root := testTree()
+	want := []string{"/tree/root/libs/b", "/tree/root/libs/a/inner", "/tree/root/libs/a", "/tree/root"}
+	if got := repoPaths(root.ReposPostOrder()); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("post order is %q, want %q", got, want)
+	}
+	got := repoPaths(FilterRepos(root.Repos(), externalsOnly, postOrder(root)))
+	if strings.Join(got, " ") != strings.Join(want[:3], " ") {
+		t.Errorf("externals only in post order are %q", got)
+	}
+}
+
+func TestChdirRelative(t *testing.T) {
+	root := diskTree(t)
+	b := &root.Externals[0]
+	for _, r := range []*Repo{root, b} {
+		if err := os.MkdirAll(filepath.Join(r.Path, "src"), 0770); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fakeGit(t, `echo "ran in $PWD"`)
+	defer func() { chdirRelative = "" }()
+
+	var err error
+	out := captureStdout(t, func() { err = cmdForeach([]string{"foreach", "-chdir-relative", "src", "status"}, root) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []*Repo{root, b} {
+		if !strings.Contains(out, "ran in "+filepath.Join(r.Path, "src")+"\n") {
+			t.Errorf("didn't run in %s/src:\n%s", r.Path, out)
+		}
+	}
+	if strings.Count(out, "ran in") != 2 || strings.Count(out, "no src, skipping") != 2 {
+		t.Errorf("ran in repos without src:\n%s", out)
+	}
+
+	for _, bad := range []string{"../src", "/src"} {
+		if err := cmdForeach([]string{"foreach", "-chdir-relative", bad, "status"}, root); err == nil {
+			t.Errorf("-chdir-relative %s wasn't an error", bad)
+		}
+	}
+}
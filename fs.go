@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// FS is the filesystem gish uses for config files, ignore files and the
+// directories it creates or removes. Commands that git runs are unaffected.
+type FS interface {
+	Stat(name string) (os.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	MkdirAll(path string, perm os.FileMode) error
+	RemoveAll(path string) error
+	Rename(oldpath, newpath string) error
+}
+
+// The filesystem in use. Replace it with a MemFS to work without touching disk.
+var fsys FS = osFS{}
+
+// osFS is the FS of the operating system.
+type osFS struct{}
+
+func (osFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFS) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+
+func (osFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return ioutil.WriteFile(name, data, perm)
+}
+
+func (osFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (osFS) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (osFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// Write the named file by renaming a complete copy over it, so a reader or
+// an interrupted write never sees it half written.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	tmp := name + ".tmp"
+	if err := fsys.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return fsys.Rename(tmp, name)
+}
+
+// Append data to the named file, creating it if necessary.
+func appendFile(name string, data []byte, perm os.FileMode) error {
+	b, err := fsys.ReadFile(name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return fsys.WriteFile(name, append(b, data...), perm)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	check := func(name string) {
+		for _, data := range []string{"first", "second"} {
+			if err := writeFileAtomic(name, []byte(data), 0660); err != nil {
+				t.Fatal(err)
+			}
+			b, err := fsys.ReadFile(name)
+			if err != nil || string(b) != data {
+				t.Errorf("%s has %q, %v, want %q", name, b, err, data)
+			}
+		}
+		if _, err := fsys.Stat(name + ".tmp"); !os.IsNotExist(err) {
+			t.Errorf("the temporary file of %s was left behind: %v", name, err)
+		}
+	}
+
+	check(filepath.Join(t.TempDir(), "gish.conf"))
+
+	useMemFS(t)
+	if err := fsys.MkdirAll("/tree", 0770); err != nil {
+		t.Fatal(err)
+	}
+	check("/tree/gish.conf")
+	if err := writeFileAtomic("/missing/gish.conf", nil, 0660); err == nil {
+		t.Error("writing into a missing directory wasn't an error")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Problems git fsck found in a repo.
+type FsckResult struct {
+	Repo     *Repo
+	Broken   []string // Corruption: missing, broken or bad objects and errors
+	Dangling int      // Unreachable objects, harmless
+	Err      error    // git fsck failed
+}
+
+func (f *FsckResult) Corrupt() bool {
+	return len(f.Broken) > 0 || f.Err != nil
+}
+
+// Sort the lines of git fsck output into corruption and dangling objects.
+// Progress and notes such as "Checking object directories" are ignored.
+func parseFsck(out []byte) (broken []string, dangling int) {
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "dangling "):
+			dangling++
+		case strings.HasPrefix(line, "missing "),
+			strings.HasPrefix(line, "broken link"),
+			strings.HasPrefix(line, "bad "),
+			strings.HasPrefix(line, "error"),
+			strings.HasPrefix(line, "fatal:"),
+			strings.Contains(line, "corrupt"):
+			broken = append(broken, line)
+		}
+	}
+	return broken, dangling
+}
+
+// Run git fsck in each of the repos.
+func Fsck(repos []*Repo) []FsckResult {
+	var results []FsckResult
+	for _, r := range repos {
+		out, err := execCmdCapture(r.Path, "git", "fsck", "--no-progress")
+		broken, dangling := parseFsck(out)
+		results = append(results, FsckResult{Repo: r, Broken: broken, Dangling: dangling, Err: err})
+	}
+	return results
+}
+
+func cmdFsck(args []string, repo *Repo) error {
+	flags := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish fsck\n")
+		fmt.Fprint(os.Stderr, "\nRun git fsck in every repo and list the repos with problems.\n")
+	}
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return &UsageError{flags.Usage, "fsck takes no arguments."}
+	}
+
+	var corrupt int
+	for _, f := range Fsck(repo.Repos()) {
+		if f.Corrupt() {
+			corrupt++
+			fmt.Printf("Repo %s: corrupt\n", f.Repo.Label())
+			for _, line := range f.Broken {
+				fmt.Printf("\t%s\n", line)
+			}
+			if f.Err != nil && len(f.Broken) == 0 {
+				fmt.Printf("\tgit fsck failed: %v\n", f.Err)
+			}
+		} else if f.Dangling > 0 {
+			fmt.Printf("Repo %s: %d dangling objects\n", f.Repo.Label(), f.Dangling)
+		}
+	}
+
+	if corrupt > 0 {
+		return fmt.Errorf("%d repo(s) are corrupt", corrupt)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFsck(t *testing.T) {
+	out := []byte(`Checking object directories: 100% (256/256), done.
+dangling commit 1f2e3d4c5b6a79881f2e3d4c5b6a79881f2e3d4c
+dangling blob 2e3d4c5b6a79881f2e3d4c5b6a79881f2e3d4c5b
+missing tree 3d4c5b6a79881f2e3d4c5b6a79881f2e3d4c5b6a
+broken link from    tree 4c5b6a79881f2e3d4c5b6a79881f2e3d4c5b6a79
+error: object file .git/objects/5b/6a79 is empty
+notice: HEAD points to an unborn branch (master)
+`)
+	broken, dangling := parseFsck(out)
+	if dangling != 2 {
+		t.Errorf("%d dangling objects, want 2", dangling)
+	}
+	want := []string{
+		"missing tree 3d4c5b6a79881f2e3d4c5b6a79881f2e3d4c5b6a",
+		"broken link from    tree 4c5b6a79881f2e3d4c5b6a79881f2e3d4c5b6a79",
+		"error: object file .git/objects/5b/6a79 is empty",
+	}
+	if !reflect.DeepEqual(broken, want) {
+		t.Errorf("broken is %q, want %q", broken, want)
+	}
+
+	if broken, dangling := parseFsck([]byte("Checking objects: 100% (12/12), done.\n")); broken != nil || dangling != 0 {
+		t.Errorf("a clean fsck gave %q and %d dangling", broken, dangling)
+	}
+}
@@ -9,28 +9,41 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"net/url"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 )
 
 const (
 	defaultCheckoutArgs = "--no-minimize-url"
 
-	ignoreRelPath = ".git/info/exclude"
-	cacheRelPath  = ".git/info/gish.conf"
-	oldCachePath  = "git_svn_externals"
+	ignoreRelPath  = "info/exclude"        // In the git dir
+	managedRelPath = "info/gish-externals" // In the git dir, externals gish has ignored
+	cacheRelPath   = ".git/info/gish.conf"
+	lockRelPath    = ".git/info/gish.lock"
+	bareCachePath  = "info/gish.conf" // Config of a bare mirror
+	oldCachePath   = "git_svn_externals"
 )
 
 var (
 	dryRun, force bool // cmdClean
+	forceNested   bool // cmdClean
 	askForArgs    bool // clone
+	initFetch     bool // clone
+	skipFailed    bool // clone, sync
+	compactConfig bool // Store the config without indentation
+	forceConfig   bool // Store the config even if it has fewer repos than the stored one
+	traceCmds     bool // Print each command before it runs
+
+	extraEnv    envFlag // Added to the environment of every command gish runs
+	configFile  string  // Explicit config file to load and store the tree in
+	manifestDir string  // clone
 )
 
 func UsageExit(usage func(), msg string) {
@@ -39,97 +52,243 @@ func UsageExit(usage func(), msg string) {
 	os.Exit(1)
 }
 
+// UsageError reports invalid command line arguments.
+// main prints the message followed by the command's usage.
+type UsageError struct {
+	Usage func()
+	Msg   string
+}
+
+func (e *UsageError) Error() string {
+	return e.Msg
+}
+
+// Returned for command line errors that have already been printed.
+var errReported = errors.New("error already reported")
+
+// Parse the flags of a command. The flag set prints parse errors along with
+// the usage, so they're returned as errReported. -h returns flag.ErrHelp.
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	err := flags.Parse(args)
+	if err != nil && err != flag.ErrHelp {
+		return errReported
+	}
+	return err
+}
+
+// Return the args with the options of flags before the command ready for the
+// flag package, which doesn't accept a value run into a one letter option
+// such as -j4. The options end at the command or at --, and what follows is
+// the command's, passed on untouched even if it looks like a gish option.
+func globalArgs(flags *flag.FlagSet, args []string) []string {
+	out := append([]string(nil), args...)
+	for i := 0; i < len(out); i++ {
+		a := out[i]
+		if a == "--" || a == "-" || !strings.HasPrefix(a, "-") {
+			break
+		}
+		name := strings.TrimLeft(a, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		if flags.Lookup(name) == nil && len(name) > 1 && flags.Lookup(name[:1]) != nil {
+			out[i] = a[:len(a)-len(name)] + name[:1] + "=" + name[1:]
+			continue
+		}
+		if f := flags.Lookup(name); f != nil && !isBoolFlag(f) {
+			i++ // The value is the next arg.
+		}
+	}
+	return out
+}
+
 func Usage() {
-	fmt.Fprint(os.Stderr, "usage:\n\tgish <command> [options]\n")
+	fmt.Fprint(os.Stderr, "usage:\n\tgish [options] <command> [command options]\n")
 	fmt.Fprint(os.Stderr, "Commands:\n")
-	fmt.Fprint(os.Stderr, "\tclone: clone the repo's externals.\n")
-	fmt.Fprint(os.Stderr, "\tlist: list the root path of the current git repo and the paths to its externals.\n")
-	fmt.Fprint(os.Stderr, "\tclean: perform git clean without removing externals\n")
-	fmt.Fprint(os.Stderr, "\tupdateignores: add externals to git ignore. Done automatically with clone.\n")
+	for _, name := range commandNames() {
+		fmt.Fprintf(os.Stderr, "\t%s: %s\n", name, commands[name].Summary)
+	}
 	fmt.Fprint(os.Stderr, "\n\tOther commands are passed directly to git along with their arguments.\n")
 	fmt.Fprint(os.Stderr, "\n\tUse 'gish <command> -h' for command-specific help.\n")
 
-	/*
-		fmt.Fprint(os.Stderr, "Options:\n")
-		flag.PrintDefaults()
-	*/
+	fmt.Fprint(os.Stderr, "Options:\n")
+	flag.PrintDefaults()
 }
 
-// Execute the given command with its input connected to stdin.
-func execCmd(dir, arg0 string, args ...string) error {
+// Create a command to run in dir. Its environment is the user's environment
+// plus the -env settings and then env.
+func newCmd(dir string, env []string, arg0 string, args ...string) *exec.Cmd {
+	arg0, args = bwLimited(arg0, args)
 	cmd := exec.Command(arg0, args...)
-	cmd.Env = os.Environ()
+	cmd.Env = append(append(os.Environ(), extraEnv...), env...)
 	cmd.Dir = dir
+	if traceCmds {
+		traceCmd(dir, append(append([]string{}, extraEnv...), env...), append([]string{arg0}, args...))
+	}
+	return cmd
+}
+
+// Print a command about to run to stderr, with the directory it runs in and
+// the environment gish adds.
+func traceCmd(dir string, env, argv []string) {
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	words := append(env, argv...)
+	for i, w := range words {
+		if w == "" || strings.ContainsAny(w, " \t\n\"'\\$*?[]{}()<>|&;") {
+			words[i] = strconv.Quote(w)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "+ (%s) %s\n", dir, strings.Join(words, " "))
+}
+
+// Execute the given command with its input connected to stdin.
+func execCmd(dir, arg0 string, args ...string) error {
+	cmd := newCmd(dir, nil, arg0, args...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	logDone := teeCmdToLog(cmd)
+	err := cmd.Run()
+	logDone(err)
+	return err
 }
 
 // Execute the given command connecting its input to stdin, return its output as a byte slice.
 func execCmdCombinedOutput(dir, arg0 string, args ...string) ([]byte, error) {
-	cmd := exec.Command(arg0, args...)
-	cmd.Env = os.Environ()
-	cmd.Dir = dir
+	return execCmdEnv(dir, nil, arg0, args...)
+}
+
+// Like execCmdCombinedOutput, with env added to the command's environment.
+func execCmdEnv(dir string, env []string, arg0 string, args ...string) ([]byte, error) {
+	cmd := newCmd(dir, env, arg0, args...)
 	cmd.Stdin = os.Stdin
-	return cmd.CombinedOutput()
+	out, err := cmd.CombinedOutput()
+	logCmdOutput(cmd, out, err)
+	return out, err
 }
 
-// Returns true if the given directory is a git repository. (Contains a .git subdir)
-func IsRepo(repoPath string) bool {
-	rp := path.Join(repoPath, ".git")
-	info, err := os.Stat(rp)
-	if err != nil {
-		return false
+// Execute the given command without input, return its output as a byte slice.
+// Safe to use from concurrent goroutines.
+func execCmdCapture(dir, arg0 string, args ...string) ([]byte, error) {
+	cmd := newCmd(dir, nil, arg0, args...)
+	out, err := cmd.CombinedOutput()
+	logCmdOutput(cmd, out, err)
+	return out, err
+}
+
+// envFlag collects repeated -env KEY=VALUE flags.
+type envFlag []string
+
+func (e *envFlag) String() string {
+	return strings.Join(*e, " ")
+}
+
+func (e *envFlag) Set(s string) error {
+	if i := strings.Index(s, "="); i <= 0 {
+		return fmt.Errorf("%q is not in KEY=VALUE form", s)
 	}
+	*e = append(*e, s)
+	return nil
+}
 
-	return info.IsDir()
+// Returns true if the given directory is a git repository. (Contains a .git subdir,
+// or a .git file for a worktree)
+func IsRepo(repoPath string) bool {
+	isRepo, _ := checkRepo(repoPath)
+	return isRepo
 }
 
 func IsDir(path string) bool {
-	info, err := os.Stat(path)
+	isDir, _ := checkDir(path)
+	return isDir
+}
+
+// Like IsRepo, but errors other than .git not existing are returned.
+func checkRepo(repoPath string) (bool, error) {
+	_, err := fsys.Stat(path.Join(repoPath, ".git"))
 	if err != nil {
-		return false
+		if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Like IsDir, but errors other than the path not existing are returned.
+func checkDir(path string) (bool, error) {
+	info, err := fsys.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+			return false, nil
+		}
+		return false, err
 	}
-	return info.IsDir()
+	return info.IsDir(), nil
 }
 
 // Return the path to the outermost repo containing the current path.
 func FindRootRepoPath() (string, error) {
 	pwd, err := os.Getwd()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error getting pwd: ", err)
-		os.Exit(1)
+		return "", fmt.Errorf("Error getting pwd: %v", err)
 	}
 
 	parts := strings.SplitAfter(pwd, string(os.PathSeparator))
 	for i, _ := range parts {
 		testPath := path.Join(parts[:i+1]...)
-		if IsRepo(testPath) {
+		isRepo, err := checkRepo(testPath)
+		if err != nil {
+			return pwd, fmt.Errorf("Can't check %s for a repo: %v", testPath, err)
+		}
+		if isRepo {
 			return testPath, nil
 		}
 	}
 
 	// Return pwd in case we're cloning into pwd.
-	return pwd, fmt.Errorf("No .git found in %s or any parent dir.", pwd)
+	return pwd, &NotInRepoError{pwd}
+}
+
+// A NotInRepoError is returned when gish is run outside of any repo.
+type NotInRepoError struct {
+	Dir string
+}
+
+func (e *NotInRepoError) Error() string {
+	return fmt.Sprintf("Not inside a gish or git repository: no .git in %s or any parent dir. "+
+		"Run gish from within a checkout, or use 'gish clone' to create one.", e.Dir)
 }
 
 // Get svn info for the repo. Label is the string to the left of the colon in the 
 // standard svn info format. RepoPath must be a git-svn repo.
 func GitSvnInfo(repoPath, label string) (string, error) {
-	out, err := execCmdCombinedOutput(repoPath, "git", "svn", "info")
+	out, err := execCmdEnv(repoPath, cLocale, "git", "svn", "info")
 	if err != nil {
-		return "", fmt.Errorf("git svn info failed (%s), not a git repo??\n", err)
+		return "", fmt.Errorf("git svn info failed in %s (%s), is it a git-svn repo?", repoPath, err)
 	}
 
-	lines := strings.SplitAfter(string(out), "\n")
-	for _, line := range lines {
+	if value, ok := infoField(out, label); ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("attribute %s not found in git svn info", label)
+}
+
+// Environment for commands whose output is parsed, so labels such as
+// "Repository Root" aren't translated.
+var cLocale = []string{"LC_ALL=C", "LANG=C"}
+
+// Return the value of a "Label: value" line of svn info output.
+func infoField(out []byte, label string) (string, bool) {
+	for _, line := range strings.Split(string(out), "\n") {
 		w := strings.SplitN(line, ":", 2)
-		if w[0] == label {
-			return strings.TrimSpace(w[1]), nil
+		if w[0] == label && len(w) == 2 {
+			return strings.TrimSpace(w[1]), true
 		}
 	}
-	return "", fmt.Errorf("attribute %s not found in git svn info", label)
+	return "", false
 }
 
 // Replaces relative repo paths introduced in SVN 1.5.
@@ -137,56 +296,133 @@ func GitSvnInfo(repoPath, label string) (string, error) {
 //  ^/ -- Relative to the root of the repository in which the svn:externals property is versioned
 //  // -- Relative to the scheme of the URL of the directory on which the svn:externals property is set
 //   / -- Relative to the root URL of the server on which the svn:externals property is versioned
-func ReplaceRelative(repoRootUrl, externalRef string) (string, error) {
-	refParts := strings.SplitAfterN(externalRef, "/", 2)
+//
+// dirUrl is the URL of the directory on which the svn:externals property is set.
+// A fully qualified URL is left as it is, whatever its scheme, even when it
+// differs from the scheme of the repo's own URL.
+func ReplaceRelative(repoRootUrl, dirUrl, externalRef string) (string, error) {
+	if isAbsoluteUrl(externalRef) {
+		return canonicalSvnUrl(externalRef)
+	}
 
-	switch refParts[0] {
-	case "^/":
-		return fmt.Sprint(repoRootUrl, "/", refParts[1]), nil
-	case "../":
-		fallthrough
-	case "//":
-		fallthrough
-	case "/":
-		return "", errors.New("Unhandled relative extern type")
+	switch {
+	case strings.HasPrefix(externalRef, "^/"):
+		return joinUrl(repoRootUrl, externalRef[2:])
+	case strings.HasPrefix(externalRef, "../"):
+		return joinUrl(dirUrl, externalRef)
+	case strings.HasPrefix(externalRef, "//"):
+		base, err := url.Parse(dirUrl)
+		if err != nil {
+			return "", err
+		}
+		if base.Scheme == "" {
+			return "", fmt.Errorf("No scheme in %q to resolve %q", dirUrl, externalRef)
+		}
+		return canonicalSvnUrl(base.Scheme + ":" + externalRef)
+	case strings.HasPrefix(externalRef, "/"):
+		base, err := url.Parse(repoRootUrl)
+		if err != nil {
+			return "", err
+		}
+		if base.Host == "" {
+			return "", fmt.Errorf("No server in %q to resolve %q", repoRootUrl, externalRef)
+		}
+		return canonicalSvnUrl(base.Scheme + "://" + base.Host + externalRef)
 	}
 
 	// No relative content
-	return externalRef, nil
+	return canonicalSvnUrl(externalRef)
 }
 
-func GitSvnUrl(repoPath string) (url string, err error) {
-	out, err := execCmdCombinedOutput(repoPath, "git", "svn", "info")
+// Report whether ref is a fully qualified URL, a scheme followed by "//",
+// rather than one of svn's relative references.
+func isAbsoluteUrl(ref string) bool {
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme == "" {
+		return false
+	}
+	return strings.HasPrefix(ref[len(u.Scheme)+1:], "//")
+}
+
+// Join the relative url path rel, which may contain ".." and escapes such as
+// %20, onto base's path.
+func joinUrl(base, rel string) (string, error) {
+	if unescaped, err := url.PathUnescape(rel); err == nil {
+		rel = unescaped
+	}
+	return joinUrlPath(base, rel)
+}
+
+// Like joinUrl, but rel is a plain path such as a directory name, with any
+// % in it meant literally.
+func joinUrlPath(base, rel string) (string, error) {
+	u, err := url.Parse(base)
 	if err != nil {
 		return "", err
 	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
 
-	lines := strings.SplitAfter(string(out), "\n")
-	for _, line := range lines {
-		w := strings.SplitN(line, ":", 2)
-		if w[0] == "URL" {
-			return w[1], nil
-		}
+	joined := path.Join(u.Path, rel)
+	if !strings.HasPrefix(joined, "/") || (joined == "/" && strings.Contains(rel, "..")) {
+		return "", fmt.Errorf("%q goes above the root of %q", rel, base)
 	}
-	return "", fmt.Errorf("Attribute URL not found in git svn info for %s", repoPath)
+	u.Path = joined
+	return svnUrlString(u), nil
+}
+
+func GitSvnUrl(repoPath string) (url string, err error) {
+	return GitSvnInfo(repoPath, "URL")
 }
 
 type Repo struct {
 	Path           string
+	RelPath        string `json:",omitempty"` // Path of an external relative to the repo defining it
 	Url            string
+	Rev            string `json:",omitempty"` // Operative revision of an external, if pinned
+	Kind           string `json:",omitempty"` // KindGitSvn or KindGit, once checked out
 	CheckoutArgs   string
 	ExternalsKnown bool
 	Externals      []Repo
-	Root           *Repo `json:"-"` // Don't include in json
+	PathRemap      *PathRemap `json:",omitempty"` // Root only
+	Partial        bool       `json:",omitempty"` // Root only, some externals were filtered out of the clone
+	WorktreeOf     string     `json:",omitempty"` // Path of the repo this is a git worktree of
+	UUID           string     `json:",omitempty"` // Repository UUID of the svn repository, to notice it being re-created
+	SvnRemote      *SvnRemote `json:",omitempty"` // git-svn layout of a repo cloned with branches or tags
+	Root           *Repo      `json:"-"`          // Don't include in json
+
+	shrinkOK bool // Root only, repos were removed from the tree on purpose
 }
 
+// Discover the repo's externals. A repo without externals is not an error,
+// but failing to read them is, so the two aren't confused.
 func (repo *Repo) LoadExternals() error {
-	rawExternals, err := execCmdCombinedOutput(repo.Path, "git", "svn", "show-externals")
+	rawExternals, err := repo.rawExternals()
 	if err != nil {
 		return err
 	}
 
-	return repo.CookExternals(string(rawExternals))
+	err = repo.CookExternals(rawExternals)
+	if err != nil {
+		return err
+	}
+
+	if len(repo.Externals) == 0 {
+		fmt.Fprintf(os.Stderr, "Repo %s has no externals.\n", repo.Path)
+	}
+	return nil
+}
+
+// Return the directory path of a 'git svn show-externals' header line, "# "
+// followed by the path. Only the line ending is removed, so the path is exactly
+// the prefix of the externals lines under it, whatever characters it has.
+func externalsHeader(line string) (string, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "# ") {
+		return "", false
+	}
+	return line[2:], true
 }
 
 func (repo *Repo) CookExternals(rawExternals string) error {
@@ -196,44 +432,172 @@ func (repo *Repo) CookExternals(rawExternals string) error {
 		EXT
 	)
 
-	var lastPath []string
-	pathRegex := regexp.MustCompile(`^#\s(.*)`)
+	var lastPath string
+	var found []Repo
+	var repoRoot string
 	lines := strings.SplitAfter(rawExternals, "\n")
 	expecting := PATH
 	for _, line := range lines {
 		if expecting == PATH {
-			lastPath = pathRegex.FindStringSubmatch(line)
-			if lastPath != nil {
+			if header, ok := externalsHeader(line); ok {
+				lastPath = header
 				expecting = EXT
 			} else {
 			}
 		} else if expecting == EXT {
-			pat := fmt.Sprintf(`^%s(\S*)\s(.*)`, regexp.QuoteMeta(lastPath[1]))
-			extRegex := regexp.MustCompile(pat)
-			match := extRegex.FindStringSubmatch(line)
-			if match != nil {
-				repoRoot, err := GitSvnInfo(repo.Path, "Repository Root")
+			// A directory's block ends at a blank line or the next header,
+			// which may come straight after a block with no externals.
+			if strings.TrimSpace(line) == "" {
+				expecting = PATH
+				continue
+			}
+			if header, ok := externalsHeader(line); ok {
+				lastPath = header
+				continue
+			}
+
+			def := strings.TrimRight(line, "\r\n")
+			if strings.HasPrefix(def, lastPath) && strings.TrimSpace(def[len(lastPath):]) != "" {
+				extRef, rev, extDir, err := parseExternalDef(def[len(lastPath):])
 				if err != nil {
 					return err
 				}
 
-				svnUrl, err := ReplaceRelative(repoRoot, match[1])
+				// ^/ is relative to the repository this repo's externals
+				// are versioned in, which for an external of an external
+				// may not be the root repo's.
+				if repoRoot == "" {
+					repoRoot, err = repo.repositoryRoot()
+					if err != nil {
+						return err
+					}
+				}
+
+				dirUrl, err := joinUrlPath(repo.Url, strings.Trim(lastPath, "/"))
+				if err != nil {
+					return err
+				}
+				svnUrl, err := ReplaceRelative(repoRoot, dirUrl, extRef)
 				if err != nil {
 					return fmt.Errorf("Error with extern %v\n", err)
 				} else {
-					extPath := path.Join(repo.Path, lastPath[1], match[2])
-					repo.Externals = append(repo.Externals,
-						Repo{Path: extPath, Url: svnUrl, Root: repo.Root})
+					extPath, err := repo.remapPath(path.Join(repo.Path, lastPath, extDir))
+					if err != nil {
+						return err
+					}
+					found = append(found, Repo{Path: extPath, RelPath: relPath(repo.Path, extPath),
+						Url: svnUrl, Rev: rev, Root: repo.Root})
 				}
 			}
-			expecting = PATH
 		}
 	}
 
+	// Refuse externals that would be cloned on top of another repo in the tree.
+	// Externals of other repos may be added concurrently by a parallel clone.
+	treeMu.Lock()
+	defer treeMu.Unlock()
+	root := repo.Root
+	if root == nil {
+		root = repo
+	}
+	for i := range found {
+		if other := root.findPath(found[i].Path); other != nil {
+			return duplicatePathError(other, &found[i])
+		}
+		for j := range found[:i] {
+			if found[j].Path == found[i].Path {
+				return duplicatePathError(&found[j], &found[i])
+			}
+		}
+	}
+
+	repo.Externals = append(repo.Externals, found...)
 	repo.ExternalsKnown = true
 	return nil
 }
 
+// Split an externals definition, "[-r REV] URL[@PEG] PATH", into the url,
+// the revision and the local path. A peg revision is the operative revision
+// unless -r gives one.
+func parseExternalDef(def string) (extUrl, rev, localPath string, err error) {
+	fields := strings.Fields(def)
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "-r") {
+		rev = strings.TrimPrefix(fields[0], "-r")
+		fields = fields[1:]
+		if rev == "" && len(fields) > 0 {
+			// -r REV
+			rev = fields[0]
+			fields = fields[1:]
+		}
+		if !isRevision(rev) {
+			return "", "", "", fmt.Errorf("Bad revision in external %q", def)
+		}
+	}
+	if len(fields) < 2 {
+		return "", "", "", fmt.Errorf("Can't parse external %q, the url before the path is required", def)
+	}
+
+	extUrl = fields[0]
+	localPath = strings.Join(fields[1:], " ")
+	if at := strings.LastIndex(extUrl, "@"); at >= 0 && isRevision(extUrl[at+1:]) {
+		if rev == "" {
+			rev = extUrl[at+1:]
+		}
+		extUrl = extUrl[:at]
+	}
+	return extUrl, rev, localPath, nil
+}
+
+func isRevision(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func duplicatePathError(a, b *Repo) error {
+	return fmt.Errorf("Externals %s and %s both resolve to path %s", a.Url, b.Url, b.Path)
+}
+
+// Return the repo in the tree whose path is p, or nil if there is none.
+func (repo *Repo) findPath(p string) *Repo {
+	if path.Clean(repo.Path) == path.Clean(p) {
+		return repo
+	}
+	for i := range repo.Externals {
+		if r := repo.Externals[i].findPath(p); r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// Check that no two repos in the tree share a destination path.
+func (repo *Repo) CheckDuplicatePaths() error {
+	return repo.checkDuplicatePaths(make(map[string]*Repo))
+}
+
+func (repo *Repo) checkDuplicatePaths(seen map[string]*Repo) error {
+	p := path.Clean(repo.Path)
+	if other, ok := seen[p]; ok {
+		return duplicatePathError(other, repo)
+	}
+	seen[p] = repo
+
+	for i := range repo.Externals {
+		err := repo.Externals[i].checkDuplicatePaths(seen)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (repo *Repo) List() {
 	fmt.Println(repo.Path)
 	for _, ext := range repo.Externals {
@@ -241,6 +605,25 @@ func (repo *Repo) List() {
 	}
 }
 
+// Print the tree with each external indented under the repo that defines
+// it, named by its root relative path.
+func (repo *Repo) ListTree() {
+	fmt.Println(repo.Path)
+	repo.listTree("")
+}
+
+func (repo *Repo) listTree(indent string) {
+	for i := range repo.Externals {
+		ext := &repo.Externals[i]
+		branch, below := "├── ", "│   "
+		if i == len(repo.Externals)-1 {
+			branch, below = "└── ", "    "
+		}
+		fmt.Println(indent + branch + RootRelative(ext, ""))
+		ext.listTree(indent + below)
+	}
+}
+
 // Return a slice of the paths of the repo and all its externs
 func (repo *Repo) Paths() []string {
 	p := []string{repo.Path}
@@ -251,6 +634,26 @@ func (repo *Repo) Paths() []string {
 	return p
 }
 
+// Return a slice of the repo and all its externs, in the same order as Paths.
+func (repo *Repo) Repos() []*Repo {
+	r := []*Repo{repo}
+	for i := range repo.Externals {
+		r = append(r, repo.Externals[i].Repos()...)
+	}
+
+	return r
+}
+
+// Return the repos of the tree with each repo's externals before it, the
+// order to push in when a repo's commits depend on its externals'.
+func (repo *Repo) ReposPostOrder() []*Repo {
+	var r []*Repo
+	for i := range repo.Externals {
+		r = append(r, repo.Externals[i].ReposPostOrder()...)
+	}
+	return append(r, repo)
+}
+
 func contains(haystack [][]byte, needle []byte) bool {
 	for _, e := range haystack {
 		if bytes.Equal(e, needle) {
@@ -275,8 +678,8 @@ func (repo *Repo) ignoreExternalsAddMethod() {
 	}
 
 	var lines [][]byte
-	ignoreFilename := path.Join(repo.Path, ignoreRelPath)
-	b, err := ioutil.ReadFile(ignoreFilename)
+	ignoreFilename := path.Join(gitCommonDir(repo.Path), ignoreRelPath)
+	b, err := fsys.ReadFile(ignoreFilename)
 	if err != nil {
 		if os.IsNotExist(err) {
 		} else {
@@ -297,14 +700,7 @@ func (repo *Repo) ignoreExternalsAddMethod() {
 	}
 
 	if addBuf.Len() > 0 {
-		f, err := os.OpenFile(ignoreFilename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			return
-		}
-		defer f.Close()
-
-		_, err = addBuf.WriteTo(f)
+		err = appendFile(ignoreFilename, addBuf.Bytes(), 0666)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			return
@@ -324,32 +720,39 @@ func (repo *Repo) ignoreExternalsSubtractMethod() {
 		externsToAdd[relPath] = true
 	}
 
-	f, err := os.OpenFile(path.Join(repo.Path, ignoreRelPath),
-		os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
+	ignoreFilename := path.Join(gitCommonDir(repo.Path), ignoreRelPath)
+	b, err := fsys.ReadFile(ignoreFilename)
+	if err != nil && !os.IsNotExist(err) {
 		fmt.Fprintln(os.Stderr, "IgnoreExternals:", err)
 		return
 	}
-	defer f.Close()
 
-	bufin := bufio.NewReader(f)
-	for {
-		ignore, err := bufin.ReadString('\n')
-		if err != nil {
-			if err != io.EOF {
-				fmt.Fprintln(os.Stderr, "IgnoreExternals:", err)
-			}
-			break
-		}
+	for _, ignore := range strings.Split(string(b), "\n") {
+		// The extern is already ignored if it's in the file.
+		delete(externsToAdd, strings.TrimSpace(ignore))
+	}
 
-		if externsToAdd[ignore] {
-			// The extern is already ignored. 
-			delete(externsToAdd, ignore)
-		}
+	if len(externsToAdd) == 0 {
+		return
 	}
 
+	toAdd := make([]string, 0, len(externsToAdd))
 	for k := range externsToAdd {
-		fmt.Fprintln(f, k)
+		toAdd = append(toAdd, k)
+	}
+	sort.Strings(toAdd)
+
+	addBuf := new(bytes.Buffer)
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		addBuf.WriteByte('\n')
+	}
+	for _, k := range toAdd {
+		fmt.Fprintln(addBuf, k)
+	}
+
+	err = appendFile(ignoreFilename, addBuf.Bytes(), 0666)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "IgnoreExternals:", err)
 	}
 }
 
@@ -366,6 +769,7 @@ func (repo *Repo) IgnoreExternals() {
 	} else {
 		repo.ignoreExternalsSubtractMethod()
 	}
+	repo.recordManaged()
 }
 
 func (repo *Repo) IgnoreAllExternals() {
@@ -391,17 +795,36 @@ func (repo *Repo) LinkRoot() {
 
 func RewritePaths(repo *Repo, from, to string) {
 	repo.Path = strings.Replace(repo.Path, from, to, 1)
+	if repo.WorktreeOf != "" {
+		repo.WorktreeOf = strings.Replace(repo.WorktreeOf, from, to, 1)
+	}
 	for i := range repo.Externals {
 		RewritePaths(&repo.Externals[i], from, to)
 	}
 }
 
+// Shared by everything that prompts the user, so buffered input isn't lost
+// between prompts.
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// Ask a yes or no question, defaulting to no.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	in, err := stdinReader.ReadString('\n')
+	if err != nil && in == "" {
+		return false
+	}
+	in = strings.ToLower(strings.TrimSpace(in))
+	return in == "y" || in == "yes"
+}
+
 func (repo *Repo) getCheckoutArgs() []string {
 	if askForArgs {
+		promptMu.Lock()
+		defer promptMu.Unlock()
 		fmt.Printf("Provide checkout args for %s:\n> ", repo.Url)
 
-		buf := bufio.NewReader(os.Stdin)
-		in, err := buf.ReadString('\n')
+		in, err := stdinReader.ReadString('\n')
 		in = strings.TrimSpace(in)
 		if err == nil {
 			if in != "" {
@@ -418,95 +841,171 @@ func (repo *Repo) getCheckoutArgs() []string {
 	return []string{defaultCheckoutArgs}
 }
 
-// Check that the repo and its externals are cloned.
-func (repo *Repo) Clone() error {
-	repoPath, repoDir := path.Split(repo.Path)
+// Clone the repo itself, or update it from svn if it's already cloned.
+func (repo *Repo) checkout() error {
+	if !IsDir(repo.Path) && repo.Root != nil {
+		if src := repo.worktreeSource(); src != nil {
+			return repo.addWorktree(src)
+		}
+	}
+
+	// git svn clone can't be given the mappings, they're set between
+	// init and fetch.
+	if initFetch || (repo.SvnRemote != nil && !IsRepo(repo.Path)) {
+		return repo.initFetch()
+	}
 
 	if IsRepo(repo.Path) {
+		if repo.holdPinned() {
+			return nil
+		}
 		fmt.Printf("Path %s is a repo, updating from svn.\n", repo.Path)
-		err := execCmd(repo.Path, "git", "svn", "rebase")
-		if err != nil {
+		if err := repo.checkUUID(); err != nil {
 			return err
 		}
-	} else {
-		if IsDir(repo.Path) {
-			fmt.Fprintf(os.Stderr, "Path %s exists but is not a repo.\n", repo.Path)
-			os.Exit(1)
-		}
+		return execCmd(repo.Path, "git", "svn", "rebase")
+	}
+
+	if IsDir(repo.Path) {
+		return fmt.Errorf("Path %s exists but is not a repo.", repo.Path)
+	}
 
-		fmt.Printf("Cloning %q from svn url %q\n", repo.Path, repo.Url)
-		err := os.MkdirAll(repo.Path, 0770)
+	repoPath, repoDir, err := cloneTarget(repo.Path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Cloning %q from svn url %q\n", repo.Path, repo.Url)
+	err = fsys.MkdirAll(repo.Path, 0770)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"svn", "clone"}
+	args = append(args, repo.getCheckoutArgs()...)
+	args = append(args, repo.Url, repoDir)
+	return execCmd(repoPath, "git", args...)
+}
+
+// Split the path of a repo to clone into the directory git svn clone runs in
+// and the name of the directory it creates. Trailing slashes are ignored and
+// a path of one segment is cloned into the current directory.
+func cloneTarget(p string) (parent, dir string, err error) {
+	clean := path.Clean(p)
+	dir = path.Base(clean)
+	if dir == "/" || dir == "." || dir == ".." {
+		return "", "", fmt.Errorf("Can't clone into %q, it doesn't name a new directory", p)
+	}
+	return path.Dir(clean), dir, nil
+}
+
+// Check that the repo and its externals are cloned.
+func (repo *Repo) Clone() error {
+	if repo.Root == repo {
+		// Externals from a config are all known up front, catch collisions
+		// before anything is cloned.
+		err := repo.CheckDuplicatePaths()
 		if err != nil {
 			return err
 		}
 
-		args := []string{"svn", "clone"}
-		args = append(args, repo.getCheckoutArgs()...)
-		args = append(args, repo.Url, repoDir)
-		err = execCmd(repoPath, "git", args...)
-		if err != nil {
-			return err
+		if jobs > 1 {
+			cloneThrottle = newThrottle(jobs, jobsPerServer)
+			defer func() {
+				cloneThrottle = nil
+			}()
 		}
+
+		// Stored by the config write that follows the clone.
+		filteredOut = 0
+		defer func() {
+			repo.Partial = filteredOut > 0
+		}()
 	}
 
-	if !repo.ExternalsKnown {
-		err := repo.LoadExternals()
-		if err != nil {
-			return err
-		} else {
-			repo.IgnoreExternals()
-		}
+	finish := emitStart(repo.Path, []string{"clone", repo.Url})
+	err := repo.throttledCheckout()
+	if err == nil && repo.Root == repo && manifestDir != "" {
+		err = setManifestDir(repo.Path, manifestDir)
+	}
+	if err == nil && !repo.ExternalsKnown {
+		err = repo.LoadExternals()
+	}
+	if err == nil {
+		repo.IgnoreExternals()
 	}
+	finish(err)
+	if err != nil {
+		return err
+	}
+	kind := detectKind(repo.Path)
+	// The config may be written by the clone of another external meanwhile.
+	treeMu.Lock()
+	repo.Kind = kind
+	treeMu.Unlock()
+	repo.recordUUID()
+	repo.recordSvnRemote()
 
 	// Save the externals
 	repo.WriteConfig()
 
+	if cloneThrottle != nil {
+		return repo.cloneExternalsParallel()
+	}
+
 	for i := range repo.Externals {
-		err := repo.Externals[i].Clone()
+		ext := &repo.Externals[i]
+		if !cloneSelected(ext) {
+			filteredOut++
+			continue
+		}
+		err := ext.Clone()
 		if err != nil {
-			return err
+			if !skipFailed {
+				return err
+			}
+			recordFailedClone(ext, err)
 		}
 	}
 
 	return nil
 }
 
-// Do a 'git clean' on each repo, removing the externals from the list.
+// Do a 'git clean' on each repo, excluding the externals. git decides what
+// to remove, so files matched by .gitignore or .git/info/exclude are kept.
 func (repo *Repo) Clean() error {
 	fmt.Fprintln(os.Stderr, "Cleaning repo ", repo.Path)
 
-	toRmStr, err := execCmdCombinedOutput(repo.Path, "git", "clean", "-ndx")
-	if err != nil {
-		return err
+	cleanArgs := []string{"clean", "-d", "-f"}
+	if dryRun {
+		cleanArgs[2] = "-n"
+	}
+	// git clean skips nested repos unless -f is given twice.
+	if forceNested {
+		cleanArgs = append(cleanArgs, "-ff")
 	}
-
-	// Build a map of the externs
-	extMap := make(map[string]bool, len(repo.Externals))
 	for _, ext := range repo.Externals {
 		extRelPath := strings.Trim(strings.Replace(ext.Path, repo.Path, "", 1), "/")
-		extMap[extRelPath] = true
+		cleanArgs = append(cleanArgs, "-e", "/"+extRelPath)
 	}
 
-	toRm := strings.Split(string(toRmStr), "\n")
-	for i := range toRm {
-		r := strings.Replace(toRm[i], "Would remove ", "", 1)
-		r = strings.Trim(r, "/")
+	if !forceNested {
+		if err := repo.warnNestedRepos(cleanArgs[3:]); err != nil {
+			return err
+		}
+	}
 
-		if r == "" {
+	out, err := execCmdCombinedOutput(repo.Path, "git", cleanArgs...)
+	if err != nil {
+		os.Stderr.Write(out)
+		return err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "Would skip repository ") || strings.HasPrefix(line, "Skipping repository ") {
 			continue
 		}
-
-		qualifiedR := path.Join(repo.Path, r)
-
-		if !extMap[r] {
-			if !dryRun {
-				err = os.RemoveAll(qualifiedR)
-				if err != nil {
-					fmt.Fprintln(os.Stdout, err)
-				}
-			} else {
-				fmt.Printf("Would remove %q\n", qualifiedR)
-			}
+		if line != "" {
+			fmt.Println(line)
 		}
 	}
 
@@ -524,7 +1023,7 @@ func (repo *Repo) Clean() error {
 // repo.Path should be initialized beforehand.
 func (repo *Repo) ConvertExternCache() error {
 	fullCachePath := path.Join(repo.Path, oldCachePath)
-	b, err := ioutil.ReadFile(fullCachePath)
+	b, err := fsys.ReadFile(fullCachePath)
 	if err != nil {
 		return err
 	}
@@ -549,7 +1048,7 @@ func (repo *Repo) ConvertExternCache() error {
 		}
 	}
 
-	err = os.Remove(fullCachePath)
+	err = fsys.RemoveAll(fullCachePath)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error deleting old cache: ", err)
 	}
@@ -562,37 +1061,126 @@ func (repo *Repo) WriteConfig() error {
 	if repo.Root != repo {
 		return repo.Root.WriteConfig()
 	}
+	configWriteMu.Lock()
+	defer configWriteMu.Unlock()
+
+	// Externals may be added to the tree by a parallel clone.
+	treeMu.Lock()
+	b, err := repo.MarshalConfig()
+	n := len(repo.Repos())
+	treeMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if stored := storedRepoCount(repo.ConfigPath()); n < stored && !forceConfig && !repo.shrinkOK {
+		fmt.Fprintf(os.Stderr, "Warning: not storing a config of %d repos over the stored one of %d, use -force to store it.\n", n, stored)
+		return fmt.Errorf("Config not written, it would drop %d repos", stored-n)
+	}
 
-	b, err := json.MarshalIndent(repo, "", "  ")
+	err = writeFileAtomic(repo.ConfigPath(), b, 0660)
 	if err != nil {
 		return err
 	}
+	return repo.writeManifest(b)
+}
 
-	return ioutil.WriteFile(path.Join(repo.Path, cacheRelPath), b, 0660)
+// Return the number of repos in the config stored at configPath, 0 if there
+// is none or it can't be read.
+func storedRepoCount(configPath string) int {
+	b, err := fsys.ReadFile(configPath)
+	if err != nil {
+		return 0
+	}
+	var stored Repo
+	if json.Unmarshal(b, &stored) != nil {
+		return 0
+	}
+	return len(stored.Repos())
+}
+
+// Return the path of the file the tree's config is stored in.
+func (repo *Repo) ConfigPath() string {
+	if configFile != "" {
+		return configFilePath(configFile)
+	}
+	return path.Join(repo.Root.Path, cacheRelPath)
+}
+
+// Return the config file for a location that is either a config file or a
+// git repo, which may be a bare mirror.
+func configFilePath(location string) string {
+	if !IsDir(location) {
+		return location
+	}
+	if isBareRepo(location) {
+		return path.Join(location, bareCachePath)
+	}
+	return path.Join(location, cacheRelPath)
+}
+
+// Marshal the tree for storage. Externals are sorted by path so the stored
+// config doesn't change when they are discovered in a different order.
+func (repo *Repo) MarshalConfig() ([]byte, error) {
+	sorted := repo.sortedCopy()
+	if compactConfig {
+		return json.Marshal(&sorted)
+	}
+	return json.MarshalIndent(&sorted, "", "  ")
+}
+
+// Return a copy of the tree with externals sorted by path. The repo itself is
+// left untouched.
+func (repo *Repo) sortedCopy() Repo {
+	c := *repo
+	if len(repo.Externals) == 0 {
+		return c
+	}
+
+	c.Externals = make([]Repo, len(repo.Externals))
+	for i := range repo.Externals {
+		c.Externals[i] = repo.Externals[i].sortedCopy()
+	}
+	sort.Slice(c.Externals, func(i, j int) bool {
+		return c.Externals[i].Path < c.Externals[j].Path
+	})
+	return c
+}
+
+// Read the stored config for a location that is either a config file or a
+// git repo, returning the file it was read from. A repo falls back on its
+// manifest, which may be kept when the repo's own config isn't.
+func readConfigBytes(location string) (b []byte, source string, err error) {
+	source = configFilePath(location)
+	b, err = fsys.ReadFile(source)
+	if err != nil && IsDir(location) {
+		if dir := manifestDirOf(location); dir != "" {
+			source = path.Join(dir, manifestName)
+			b, err = fsys.ReadFile(source)
+		}
+	}
+	return b, source, err
 }
 
 // Create a Repo from a config file at the given location.
 // Location can be a path to a git repo or to a config file.
 func LoadConfig(configPath string) (repo *Repo, err error) {
 	isDir := IsDir(configPath)
-	cachePath := configPath
-	if isDir {
-		cachePath = path.Join(configPath, cacheRelPath)
-	}
 
 	// Look for new config
-	b, err := ioutil.ReadFile(cachePath)
+	b, _, err := readConfigBytes(configPath)
 	if err == nil {
 		repo = new(Repo)
 		err = json.Unmarshal(b, repo)
 	} else {
 		// Look for old externals cache
+		cachePath := configPath
 		if isDir {
 			cachePath = path.Join(configPath, oldCachePath)
 		}
-		_, err = os.Stat(cachePath)
+		_, err = fsys.Stat(cachePath)
 		if err == nil {
-			repo := &Repo{Path: configPath}
+			repo = &Repo{Path: configPath}
 			err = repo.ConvertExternCache()
 		} else {
 			err = fmt.Errorf("No config found in %s", configPath)
@@ -606,13 +1194,24 @@ func LoadConfig(configPath string) (repo *Repo, err error) {
 	return repo, err
 }
 
-func NewRepoClone(cmdLineArgs []string) (repo *Repo) {
+func NewRepoClone(cmdLineArgs []string) (repo *Repo, err error) {
 	// args are "clone", 
-	flags := flag.NewFlagSet("clone", flag.ExitOnError)
+	flags := flag.NewFlagSet("clone", flag.ContinueOnError)
 	altConfig := flags.String("c", "", "Path to config file to use if no other is found.")
+	portable := flags.String("manifest", "", "Clone the tree described by a file from 'gish export-manifest'.")
+	portableFormat := flags.String("manifest-format", "", "Format of the -manifest file, json or yaml. Taken from its extension by default.")
 	flags.BoolVar(&askForArgs, "i", false, "Interactively prompt for clone arguments.")
+	flags.BoolVar(&skipFailed, "skip-failed", false, "Keep cloning the other externals when one fails.")
+	pathPrefix := flags.String("path-prefix", "", "Clone the root's externals under this directory of the root.")
+	pathMap := flags.String("path-map", "", "File of '<path> <new path>' lines giving externals other paths.")
+	stripPrefix := flags.String("strip-prefix", "", "Remove this leading directory from the externals' paths.")
+	flags.Var(&cloneFilters, "filter", "Clone only the externals whose path, relative to the root, or a directory above it matches this glob. May be repeated.")
+	flags.StringVar(&externalsRev, "externals-rev", "", "Clone the root's externals as they were at this svn revision.")
+	flags.BoolVar(&noExternals, "no-externals", false, "Clone only the root. The externals are recorded for a later 'gish sync' to clone.")
+	flags.StringVar(&manifestDir, "manifest-dir", "", "Also keep a copy of the config in this directory.")
+	flags.BoolVar(&initFetch, "init-fetch", false, "Clone with 'git svn init' and 'git svn fetch' so an interrupted clone can be resumed.")
 	flags.Usage = func() {
-		fmt.Fprint(os.Stderr, "usage:\n\tgish clone [-c=<cfgpath> | svnUrl] [destDir]\n")
+		fmt.Fprint(os.Stderr, "usage:\n\tgish clone [-c=<cfgpath> | -manifest=<file> | svnUrl] [destDir]\n")
 		fmt.Fprint(os.Stderr, "\tStandard usage is 'gish clone <svnUrl> [destDir]'\n")
 		fmt.Fprint(os.Stderr, "\tIf a path to a gish config file (or repo containing one) is provided,\n")
 		fmt.Fprint(os.Stderr, "\tGish will use the url, externals, etc from that config.\n")
@@ -636,26 +1235,40 @@ func NewRepoClone(cmdLineArgs []string) (repo *Repo) {
 	// 'gish clone trunk cloneOfTrunk'
 
 	if len(cmdLineArgs) < 2 {
-		UsageExit(flags.Usage, "Not enough arguments to 'gish clone'.")
+		return nil, &UsageError{flags.Usage, "Not enough arguments to 'gish clone'."}
 	}
 
-	flags.Parse(cmdLineArgs[1:])
+	if err := parseFlags(flags, cmdLineArgs[1:]); err != nil {
+		return nil, err
+	}
 
 	nonFlagArgs := flags.Args()
+	if *altConfig != "" && *portable != "" {
+		return nil, &UsageError{flags.Usage, "-c and -manifest can't be used together."}
+	}
+
 	// Clone can be used three ways, two are handled here
-	if *altConfig == "" {
+	if *portable != "" {
+		if *pathPrefix != "" || *pathMap != "" || *stripPrefix != "" {
+			return nil, &UsageError{flags.Usage, "-path-prefix, -path-map and -strip-prefix can't change the paths in a manifest."}
+		}
+		if len(nonFlagArgs) != 1 {
+			return nil, &UsageError{flags.Usage, "A single destination dir is required with -manifest."}
+		}
+		return ImportManifest(*portable, nonFlagArgs[0], *portableFormat)
+	} else if *altConfig == "" {
 		// SVN URL required
 		if len(nonFlagArgs) < 1 {
-			UsageExit(flags.Usage, "Not enough arguments to 'gish clone'. SVN URL required")
+			return nil, &UsageError{flags.Usage, "Not enough arguments to 'gish clone'. SVN URL required"}
 		} else if len(nonFlagArgs) > 2 {
-			UsageExit(flags.Usage, "Too many arguments.")
+			return nil, &UsageError{flags.Usage, "Too many arguments."}
 		}
 
 		// Fill in the url provided, clone will fill the rest
 		// This check may not be worth much. Apparently "-i=false" is a valid url.
 		svnUrl, err := url.Parse(strings.TrimSpace(nonFlagArgs[0]))
 		if err != nil {
-			UsageExit(flags.Usage, fmt.Sprint("Error parsing svn Url: %q", err.Error()))
+			return nil, &UsageError{flags.Usage, fmt.Sprintf("Error parsing svn Url: %q", err.Error())}
 		}
 
 		var destDir string
@@ -668,43 +1281,75 @@ func NewRepoClone(cmdLineArgs []string) (repo *Repo) {
 
 		absDestDir, err := filepath.Abs(destDir)
 		if err != nil {
-			UsageExit(flags.Usage, fmt.Sprintf("invalid destdir %s: %v", destDir, err))
+			return nil, &UsageError{flags.Usage, fmt.Sprintf("invalid destdir %s: %v", destDir, err)}
+		}
+
+		canonical, err := canonicalSvnUrl(svnUrl.String())
+		if err != nil {
+			return nil, &UsageError{flags.Usage, fmt.Sprintf("Error parsing svn Url: %q", err.Error())}
 		}
+		repo = &Repo{Path: absDestDir, Url: canonical}
 
-		repo = &Repo{Path: absDestDir, Url: svnUrl.String()}
+		if *pathPrefix != "" || *pathMap != "" || *stripPrefix != "" {
+			repo.PathRemap = &PathRemap{}
+			if *pathPrefix != "" {
+				if err := checkRemapPath(*pathPrefix); err != nil {
+					return nil, &UsageError{flags.Usage, "-path-prefix " + err.Error()}
+				}
+				repo.PathRemap.Prefix = path.Clean(*pathPrefix)
+			}
+			if *stripPrefix != "" {
+				if err := checkRemapPath(*stripPrefix); err != nil {
+					return nil, &UsageError{flags.Usage, "-strip-prefix " + err.Error()}
+				}
+				repo.PathRemap.Strip = path.Clean(*stripPrefix)
+			}
+			if *pathMap != "" {
+				repo.PathRemap.Map, err = loadPathMap(*pathMap)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
 	} else {
 		/* TODO: If the alt-config was a path to an existing git-svn repo, we could
 				   clone it rather than going to the server.
 		           Same action if nonFlagArgs[0] is a local path... unless svn repos can be accessed locally.
 		*/
 
+		if *pathPrefix != "" || *pathMap != "" || *stripPrefix != "" {
+			return nil, &UsageError{flags.Usage, "-path-prefix, -path-map and -strip-prefix can't change the paths in a config."}
+		}
+
 		// DestDir required
 		if len(nonFlagArgs) < 1 {
-			UsageExit(flags.Usage, "Not enough arguments to 'gish clone'. Destination dir required")
+			return nil, &UsageError{flags.Usage, "Not enough arguments to 'gish clone'. Destination dir required"}
 		} else if len(nonFlagArgs) > 1 {
-			UsageExit(flags.Usage, "Too many arguments.")
+			return nil, &UsageError{flags.Usage, "Too many arguments."}
 		}
 
 		destDir, err := filepath.Abs(nonFlagArgs[0])
 		if err != nil {
-			UsageExit(flags.Usage, fmt.Sprintf("invalid destdir %s: %v", nonFlagArgs[0], err))
+			return nil, &UsageError{flags.Usage, fmt.Sprintf("invalid destdir %s: %v", nonFlagArgs[0], err)}
 		}
 
 		repo, err = LoadConfig(*altConfig)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Provided alternate config is invalid: ", err.Error())
-			os.Exit(1)
+			return nil, fmt.Errorf("Provided alternate config is invalid: %v", err)
 		}
 
 		RewritePaths(repo, repo.Path, destDir)
 	}
 
-	return repo
+	return repo, nil
 }
 
 func NewRepo(cmdLineArgs []string) (*Repo, error) {
 	if cmdLineArgs[0] == "clone" {
-		repo := NewRepoClone(cmdLineArgs)
+		repo, err := NewRepoClone(cmdLineArgs)
+		if err != nil {
+			return nil, err
+		}
 		// The root member of the root repo points to itself.
 		// Code can always jump through the root pointer to get to the root.
 		// Recursive code will have to test or have separate initial/root functions.
@@ -714,6 +1359,17 @@ func NewRepo(cmdLineArgs []string) (*Repo, error) {
 	}
 
 	rootPath, err := FindRootRepoPath()
+	if configFile != "" {
+		// An explicit config doesn't need to be run from inside the tree.
+		repo, lerr := LoadConfig(configFile)
+		if lerr != nil {
+			return nil, lerr
+		}
+		if err == nil {
+			RewritePaths(repo, repo.Path, rootPath)
+		}
+		return repo, nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -732,7 +1388,7 @@ func NewRepo(cmdLineArgs []string) (*Repo, error) {
 	fmt.Printf("Loading info from git. This may take a while.\n")
 	url, err := GitSvnInfo(rootPath, "URL")
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("Can't load the tree at %s, it has no gish config: %v", rootPath, err)
 	}
 
 	repo := &Repo{Path: rootPath, Url: url}
@@ -746,10 +1402,53 @@ func NewRepo(cmdLineArgs []string) (*Repo, error) {
 	return repo, nil
 }
 
-func cmdClean(args []string, repo *Repo) {
-	flags := flag.NewFlagSet("clean", flag.ExitOnError)
+// Return the path of a git repo at or under p, "" if there is none.
+func findNestedRepo(p string) string {
+	var nested string
+	filepath.Walk(p, func(walked string, info os.FileInfo, err error) error {
+		if err != nil || nested != "" {
+			return filepath.SkipDir
+		}
+		if info.Name() == ".git" {
+			nested = filepath.Dir(walked)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return nested
+}
+
+// Warn about the git repos that git clean would remove if -f were given
+// twice, which aren't externals. git skips them without saying so.
+func (repo *Repo) warnNestedRepos(excludes []string) error {
+	args := append([]string{"clean", "-d", "-n", "-ff"}, excludes...)
+	out, err := execCmdCombinedOutput(repo.Path, "git", args...)
+	if err != nil {
+		os.Stderr.Write(out)
+		return err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		r := strings.TrimPrefix(line, "Would remove ")
+		if r == line || !strings.HasSuffix(r, "/") {
+			continue
+		}
+		nested := findNestedRepo(path.Join(repo.Path, r))
+		if nested != "" && repo.Root.findPath(nested) == nil {
+			warnNestedRepo(nested)
+		}
+	}
+	return nil
+}
+
+func warnNestedRepo(p string) {
+	fmt.Fprintf(os.Stderr, "Skipping %s, a git repo gish doesn't manage. Use -force-nested to remove it.\n", p)
+}
+
+func cmdClean(args []string, repo *Repo) error {
+	flags := flag.NewFlagSet("clean", flag.ContinueOnError)
 	flags.BoolVar(&dryRun, "n", false, "List the files that would be removed.")
 	flags.BoolVar(&force, "f", false, "Enable file removal. Like git, -n or -f is required for clean.")
+	flags.BoolVar(&forceNested, "force-nested", false, "Also remove git repos that aren't externals. They're skipped otherwise.")
 	flags.Usage = func() {
 		fmt.Fprint(os.Stderr, "usage:\n\tgish clean [options]\n")
 		fmt.Fprint(os.Stderr, "Options:\n")
@@ -757,71 +1456,124 @@ func cmdClean(args []string, repo *Repo) {
 	}
 
 	if len(args) < 2 {
-		UsageExit(flags.Usage, "Not enough arguments to 'gish clean'.")
+		return &UsageError{flags.Usage, "Not enough arguments to 'gish clean'."}
 	}
 
-	flags.Parse(args[1:])
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
 
 	if !force && !dryRun {
-		UsageExit(flags.Usage, "-n or -f required for clean.")
+		return &UsageError{flags.Usage, "-n or -f required for clean."}
 	}
 
-	repo.Clean()
+	return repo.Clean()
 }
 
 func main() {
 	flag.Usage = Usage
-	flag.Parse()
-
-	cmdLineArgs := flag.Args()
-	if len(cmdLineArgs) == 0 {
-		UsageExit(Usage, "No command provided.")
+	flag.BoolVar(&compactConfig, "compact", false, "Store the config as compact JSON.")
+	flag.BoolVar(&forceConfig, "force", false, "Store the config even if it has fewer repos than the one already stored.")
+	flag.StringVar(&configFile, "config", "", "Load the tree from this config file and store it back there.")
+	flag.Var(&extraEnv, "env", "Set KEY=VALUE in the environment of the commands gish runs. May be repeated.")
+	flag.IntVar(&jobs, "j", jobs, "Number of repos to run git commands in at once.")
+	flag.IntVar(&jobsPerServer, "jobs-per-server", 0, "Limit on concurrent git commands per svn server, 0 for no limit.")
+	flag.BoolVar(&noHeaders, "no-headers", false, "Don't print the header naming each repo before its git output.")
+	flag.IntVar(&maxErrors, "max-errors", 0, "Stop running git in more repos after it fails in this many, 0 for no limit.")
+	flag.StringVar(&eventsDest, "events-json", "", "Write a JSON line for each repo a command starts and finishes in to this file, - for stdout.")
+	flag.StringVar(&logFile, "log-file", "", "Also write the output of every command gish runs to this file, with timestamps.")
+	flag.BoolVar(&fullPath, "full-path", false, "Name repos by their full path in the headers before their output, rather than by a short label.")
+	flag.StringVar(&bwLimit, "bwlimit", "", "Limit clones and fetches to this rate in KB/s, by running them under -bwlimit-cmd.")
+	flag.StringVar(&bwLimitCmd, "bwlimit-cmd", defaultBwLimitCmd, "Command to limit bandwidth with, {rate} is replaced by the -bwlimit rate.")
+	flag.BoolVar(&traceCmds, "trace", os.Getenv("GISH_TRACE") == "1", "Print each command gish runs to stderr before running it. Also set by GISH_TRACE=1.")
+	flag.CommandLine.Parse(globalArgs(flag.CommandLine, os.Args[1:]))
+
+	if err := openCmdLog(logFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := openEvents(eventsDest); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	/* TODO: NewRepo should be integrated into a Command interface then there
-	   is ONE test for the args, then everything else below that that is Command code
-	   has Command context, and any Command context that affects Repo becomes a parameter
+	err := run(flag.Args())
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	} else if err == errReported {
+		os.Exit(2)
+	} else if err != nil {
+		if usageErr, ok := err.(*UsageError); ok {
+			UsageExit(usageErr.Usage, usageErr.Msg)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
 
-	   A command has Flags, minArgs, and an action. 
-	   type Command interface {
-	       Match(args []string) true
+func run(cmdLineArgs []string) error {
+	if len(cmdLineArgs) == 0 {
+		return &UsageError{Usage, "No command provided."}
+	}
 
-	   }
-	*/
+	cmd, registered := commands[cmdLineArgs[0]]
+	if registered && cmd.NoRepo {
+		return cmd.Run(cmdLineArgs, nil)
+	}
 
 	repo, err := NewRepo(cmdLineArgs)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return err
 	}
+	return dispatch(cmdLineArgs, repo)
+}
 
-	switch cmdLineArgs[0] {
-	case "clone":
-		err = repo.Clone()
-		if err != nil { // Skip the config write. Clone() writes config for each successful clone.
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
-		}
-	case "list":
-		repo.List()
-	case "clean":
-		cmdClean(cmdLineArgs, repo)
-	case "updateignores":
-		repo.IgnoreAllExternals()
-	default:
-		paths := repo.Paths()
-		for _, path := range paths {
-			fmt.Printf("Repo %s:\n", path)
-			err = execCmd(path, "git", cmdLineArgs...)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, "Git returned error:", err)
-				// Don't quit, commands that get paged will return error.
-			}
+// Run a command against a loaded tree, passing it to git if it isn't
+// registered, and store the config afterwards.
+func dispatch(cmdLineArgs []string, repo *Repo) (err error) {
+	cmd, registered := commands[cmdLineArgs[0]]
+	if registered && cmd.NoRepo {
+		return cmd.Run(cmdLineArgs, nil)
+	}
+
+	repo.DetectKinds()
+
+	if !registered || !cmd.ReadOnly {
+		lock, err := repo.Lock()
+		if err != nil {
+			return err
 		}
+		defer lock.Unlock()
 	}
 
-	err = repo.WriteConfig()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error writing config: ", err)
+	if err := repo.runPreHook(cmdLineArgs[0]); err != nil {
+		return err
 	}
+	defer func() { repo.runPostHook(cmdLineArgs[0], err) }()
+
+	if registered {
+		err = cmd.Run(cmdLineArgs, repo)
+		if err != nil && cmd.SavesConfig {
+			// Skip the config write, the command stored what succeeded.
+			return err
+		}
+	} else if isSvnUpdate(cmdLineArgs) {
+		err = checkUUIDs(repo.Repos())
+		if err == nil {
+			err = Foreach(repo.Repos(), cmdLineArgs)
+		}
+	} else {
+		err = Foreach(repo.Repos(), cmdLineArgs)
+	}
+
+	// Without the lock the config may be written by another gish since
+	// this one loaded it.
+	if registered && cmd.ReadOnly {
+		return err
+	}
+	if werr := repo.WriteConfig(); werr != nil {
+		fmt.Fprintln(os.Stderr, "Error writing config: ", werr)
+	}
+
+	return err
 }
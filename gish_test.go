@@ -0,0 +1,622 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Run the test against an empty in-memory fs.
+func useMemFS(t *testing.T) *MemFS {
+	m := NewMemFS()
+	saved := fsys
+	fsys = m
+	t.Cleanup(func() { fsys = saved })
+	return m
+}
+
+// Make the directories of a repo at repoPath on the fs.
+func makeRepo(t *testing.T, repoPath string) {
+	if err := fsys.MkdirAll(path.Join(repoPath, ".git", "info"), 0770); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Put an svn on PATH whose svn info gives repoRoot as the repository root,
+// for reading externals without a server.
+func fakeSvn(t *testing.T, repoRoot string) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho 'Repository Root: " + repoRoot + "'\n"
+	if err := os.WriteFile(filepath.Join(dir, "svn"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// Return a root repo at /tree/root with no externals, ready to cook some.
+func cookRoot(t *testing.T) *Repo {
+	useMemFS(t)
+	fakeSvn(t, "https://svn.example.com/repo")
+	root := &Repo{Path: "/tree/root", Url: "https://svn.example.com/repo/trunk"}
+	root.LinkRoot()
+	return root
+}
+
+func testTree() *Repo {
+	root := &Repo{Path: "/tree/root", Url: "https://svn.example.com/repo/trunk", ExternalsKnown: true}
+	root.Externals = []Repo{
+		{Path: "/tree/root/libs/b", Url: "https://svn.example.com/repo/libs/b", ExternalsKnown: true},
+		{Path: "/tree/root/libs/a", Url: "svn://other.example.com/a", Rev: "12", ExternalsKnown: true,
+			Externals: []Repo{{Path: "/tree/root/libs/a/inner", Url: "svn://other.example.com/inner"}}},
+	}
+	root.LinkRoot()
+	return root
+}
+
+func TestWriteLoadConfig(t *testing.T) {
+	useMemFS(t)
+	makeRepo(t, "/tree/root")
+
+	root := testTree()
+	if err := root.WriteConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadConfig(root.ConfigPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"/tree/root":              "https://svn.example.com/repo/trunk",
+		"/tree/root/libs/a":       "svn://other.example.com/a",
+		"/tree/root/libs/a/inner": "svn://other.example.com/inner",
+		"/tree/root/libs/b":       "https://svn.example.com/repo/libs/b",
+	}
+	repos := loaded.Repos()
+	if len(repos) != len(want) {
+		t.Fatalf("loaded %d repos, want %d", len(repos), len(want))
+	}
+	for _, r := range repos {
+		if want[r.Path] != r.Url {
+			t.Errorf("%s: url %q, want %q", r.Path, r.Url, want[r.Path])
+		}
+		if r.Root != loaded {
+			t.Errorf("%s isn't linked to the root", r.Path)
+		}
+	}
+	// Externals are stored sorted by path.
+	if loaded.Externals[0].Path != "/tree/root/libs/a" || loaded.Externals[0].Rev != "12" {
+		t.Errorf("first external is %s at %q", loaded.Externals[0].Path, loaded.Externals[0].Rev)
+	}
+}
+
+func TestLoadConfigMissing(t *testing.T) {
+	useMemFS(t)
+	if _, err := LoadConfig("/nowhere/gish.conf"); err == nil {
+		t.Error("loaded a config that doesn't exist")
+	}
+}
+
+func TestIgnoreExternals(t *testing.T) {
+	useMemFS(t)
+	makeRepo(t, "/tree/root")
+	exclude := "/tree/root/.git/info/exclude"
+	if err := fsys.WriteFile(exclude, []byte("# user entries\n*.swp\nlibs/b"), 0660); err != nil {
+		t.Fatal(err)
+	}
+
+	root := testTree()
+	root.IgnoreExternals()
+	root.IgnoreExternals()
+
+	b, err := fsys.ReadFile(exclude)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "# user entries\n*.swp\nlibs/b\nlibs/a\n"; got != want {
+		t.Errorf("exclude is %q, want %q", got, want)
+	}
+}
+
+func TestReplaceRelative(t *testing.T) {
+	const root = "https://svn.example.com/repo"
+	const dir = "https://svn.example.com/repo/trunk/app"
+	for _, c := range []struct{ ref, want string }{
+		{"^/libs/a", "https://svn.example.com/repo/libs/a"},
+		{"../libs/b", "https://svn.example.com/repo/trunk/libs/b"},
+		{"../../branches/x%20y", "https://svn.example.com/repo/branches/x%20y"},
+		{"//mirror.example.com/repo/c", "https://mirror.example.com/repo/c"},
+		{"/other/d", "https://svn.example.com/other/d"},
+		{"svn://elsewhere.example.com/e", "svn://elsewhere.example.com/e"},
+		{"file:///srv/svn/f", "file:///srv/svn/f"},
+	} {
+		got, err := ReplaceRelative(root, dir, c.ref)
+		if err != nil {
+			t.Errorf("%s: %v", c.ref, err)
+		} else if got != c.want {
+			t.Errorf("%s resolved to %s, want %s", c.ref, got, c.want)
+		}
+	}
+
+	if _, err := ReplaceRelative(root, dir, "^/../.."); err == nil {
+		t.Error("resolved a url at the server root")
+	}
+}
+
+func TestIsAbsoluteUrl(t *testing.T) {
+	for ref, want := range map[string]bool{
+		"svn://elsewhere.example.com/e":   true,
+		"svn+ssh://host.example.com/r":    true,
+		"http://insecure.example.com/r":   true,
+		"file:///srv/svn/f":               true,
+		"//mirror.example.com/repo/c":     false,
+		"^/libs/a":                        false,
+		"../libs/b":                       false,
+		"/other/d":                        false,
+		"c:/not/a/url":                    false,
+		"https://svn.example.com/a%zzbad": false,
+	} {
+		if got := isAbsoluteUrl(ref); got != want {
+			t.Errorf("isAbsoluteUrl(%q) is %v", ref, got)
+		}
+	}
+
+	// A url of another scheme than the repo's is used as it is.
+	got, err := ReplaceRelative("https://svn.example.com/repo", "https://svn.example.com/repo/trunk",
+		"svn+ssh://svn.example.com/repo/libs/a")
+	if err != nil || got != "svn+ssh://svn.example.com/repo/libs/a" {
+		t.Errorf("an svn+ssh external of an https repo resolved to %q, %v", got, err)
+	}
+}
+
+func TestCookExternalsDuplicatePaths(t *testing.T) {
+	root := cookRoot(t)
+	err := root.CookExternals("# /\n/^/libs/a lib\n/^/libs/b lib\n")
+	if err == nil || !strings.Contains(err.Error(), "/tree/root/lib") {
+		t.Errorf("two externals at lib gave %v", err)
+	}
+
+	root = cookRoot(t)
+	root.Externals = []Repo{{Path: "/tree/root/lib", Url: "https://svn.example.com/repo/libs/a"}}
+	root.LinkRoot()
+	sub := &root.Externals[0]
+	if err := sub.CookExternals("# /\n/^/libs/c ../lib\n"); err == nil || !strings.Contains(err.Error(), "both resolve") {
+		t.Error("an external on top of its own repo was accepted")
+	}
+
+	if err := testTree().CheckDuplicatePaths(); err != nil {
+		t.Errorf("a tree without duplicates: %v", err)
+	}
+	dup := testTree()
+	dup.Externals[1].Externals[0].Path = "/tree/root/libs/b"
+	if err := dup.CheckDuplicatePaths(); err == nil {
+		t.Error("a tree with two repos at libs/b passed")
+	}
+}
+
+func TestNewRepoCloneUsageErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"clone"},
+		{"clone", "https://svn.example.com/repo/trunk", "dest", "extra"},
+		{"clone", "-c", "gish.conf", "-manifest", "tree.json", "dest"},
+		{"clone", "-manifest", "tree.json", "-path-prefix", "ext", "dest"},
+		{"clone", "-path-prefix", "../out", "https://svn.example.com/repo/trunk"},
+	} {
+		_, err := NewRepoClone(args)
+		if _, ok := err.(*UsageError); !ok {
+			t.Errorf("%q returned %v, want a usage error", args, err)
+		}
+	}
+}
+
+func TestMarshalConfigSortsExternals(t *testing.T) {
+	root := testTree()
+	b, err := root.MarshalConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ia, ib := strings.Index(string(b), "libs/a\""), strings.Index(string(b), "libs/b\""); ia < 0 || ia > ib {
+		t.Errorf("libs/a isn't stored before libs/b:\n%s", b)
+	}
+	if root.Externals[0].Path != "/tree/root/libs/b" {
+		t.Error("marshalling reordered the tree itself")
+	}
+	if !strings.Contains(string(b), "\n  \"Url\"") {
+		t.Errorf("config isn't indented:\n%s", b)
+	}
+
+	compactConfig = true
+	defer func() { compactConfig = false }()
+	b, err = root.MarshalConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "\n") {
+		t.Errorf("compact config has newlines:\n%s", b)
+	}
+}
+
+// An FS whose Stat fails with a permission error under denied.
+type denyFS struct {
+	*MemFS
+	denied string
+}
+
+func (d denyFS) Stat(name string) (os.FileInfo, error) {
+	if strings.HasPrefix(name, d.denied) {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrPermission}
+	}
+	return d.MemFS.Stat(name)
+}
+
+func TestCheckRepoAndDir(t *testing.T) {
+	m := useMemFS(t)
+	makeRepo(t, "/tree/root")
+	if err := fsys.WriteFile("/tree/file", nil, 0660); err != nil {
+		t.Fatal(err)
+	}
+	fsys = denyFS{m, "/tree/locked"}
+
+	for _, c := range []struct {
+		path            string
+		isRepo, isDir   bool
+		repoErr, dirErr bool
+	}{
+		{"/tree/root", true, true, false, false},
+		{"/tree/missing", false, false, false, false},
+		{"/tree/file", false, false, false, false},
+		{"/tree/locked", false, false, true, true},
+	} {
+		isRepo, err := checkRepo(c.path)
+		if isRepo != c.isRepo || (err != nil) != c.repoErr {
+			t.Errorf("checkRepo(%s) = %v, %v", c.path, isRepo, err)
+		}
+		isDir, err := checkDir(c.path)
+		if isDir != c.isDir || (err != nil) != c.dirErr {
+			t.Errorf("checkDir(%s) = %v, %v", c.path, isDir, err)
+		}
+		if IsRepo(c.path) != c.isRepo || IsDir(c.path) != c.isDir {
+			t.Errorf("IsRepo or IsDir of %s disagrees", c.path)
+		}
+	}
+}
+
+func TestEnvFlag(t *testing.T) {
+	var e envFlag
+	for _, s := range []string{"A=1", "B=two words", "C="} {
+		if err := e.Set(s); err != nil {
+			t.Errorf("%q: %v", s, err)
+		}
+	}
+	for _, s := range []string{"A", "=1", ""} {
+		if err := e.Set(s); err == nil {
+			t.Errorf("%q was accepted", s)
+		}
+	}
+
+	saved := extraEnv
+	extraEnv = e
+	defer func() { extraEnv = saved }()
+	cmd := newCmd("", []string{"LC_ALL=C"}, "git", "status")
+	env := strings.Join(cmd.Env, "\n")
+	if !strings.Contains(env, "\nA=1\nB=two words\nC=\nLC_ALL=C") {
+		t.Errorf("the command's environment doesn't end with the -env settings: %q", cmd.Env)
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	useMemFS(t)
+	makeRepo(t, "/tree/root")
+	makeRepo(t, "/tree/other")
+	if err := fsys.MkdirAll("/ci", 0770); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { configFile = "" }()
+
+	root := testTree()
+	for _, c := range []struct{ location, want string }{
+		{"", "/tree/root/" + cacheRelPath},
+		{"/ci/tree.json", "/ci/tree.json"},
+		{"/tree/other", "/tree/other/" + cacheRelPath},
+	} {
+		configFile = c.location
+		if got := root.ConfigPath(); got != c.want {
+			t.Errorf("-config %q stores in %s, want %s", c.location, got, c.want)
+		}
+	}
+
+	configFile = "/ci/tree.json"
+	if err := root.WriteConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat(path.Join(root.Path, cacheRelPath)); err == nil {
+		t.Error("the config was stored in the repo as well")
+	}
+	loaded, err := LoadConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Repos()) != len(root.Repos()) {
+		t.Errorf("loaded %d repos from %s", len(loaded.Repos()), configFile)
+	}
+}
+
+func TestParseExternalDef(t *testing.T) {
+	for _, c := range []struct{ def, url, rev, path string }{
+		{"^/libs/a lib/a", "^/libs/a", "", "lib/a"},
+		{"-r12 ^/libs/a lib/a", "^/libs/a", "12", "lib/a"},
+		{"-r 12 ^/libs/a lib/a", "^/libs/a", "12", "lib/a"},
+		{"^/libs/a@7 lib/a", "^/libs/a", "7", "lib/a"},
+		{"-r12 ^/libs/a@7 lib/a", "^/libs/a", "12", "lib/a"},
+		{"https://user@svn.example.com/a my lib", "https://user@svn.example.com/a", "", "my lib"},
+	} {
+		u, rev, p, err := parseExternalDef(c.def)
+		if err != nil {
+			t.Errorf("%q: %v", c.def, err)
+		} else if u != c.url || rev != c.rev || p != c.path {
+			t.Errorf("%q parsed to %q %q %q", c.def, u, rev, p)
+		}
+	}
+
+	for _, def := range []string{"", "^/libs/a", "-r12 ^/libs/a", "-rHEAD ^/libs/a lib", "-r"} {
+		if _, _, _, err := parseExternalDef(def); err == nil {
+			t.Errorf("%q was parsed", def)
+		}
+	}
+
+	root := cookRoot(t)
+	if err := root.CookExternals("# /\n/-r 12 ^/libs/a lib/a\n"); err != nil {
+		t.Fatal(err)
+	}
+	if ext := root.Externals[0]; ext.Url != "https://svn.example.com/repo/libs/a" || ext.Rev != "12" {
+		t.Errorf("cooked %+v", ext)
+	}
+}
+
+func TestCookExternalsEmptyBlocks(t *testing.T) {
+	root := cookRoot(t)
+	raw := "# /cleared/\n" +
+		"\n" +
+		"# /src/\n" +
+		"/src/^/libs/a a\n" +
+		"\n" +
+		"# /also/cleared/\n" +
+		"# /lib/\n" +
+		"/lib/^/libs/b b\n"
+	if err := root.CookExternals(raw); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, ext := range root.Externals {
+		got = append(got, ext.Path+" "+ext.Url)
+	}
+	want := []string{
+		"/tree/root/src/a https://svn.example.com/repo/libs/a",
+		"/tree/root/lib/b https://svn.example.com/repo/libs/b",
+	}
+	if !sameStrings(got, want) {
+		t.Errorf("cooked %q, want %q", got, want)
+	}
+}
+
+func TestCookExternalsMetacharHeaders(t *testing.T) {
+	root := cookRoot(t)
+	raw := "# /src (old)/\n" +
+		"/src (old)/^/libs/a a\n" +
+		"# /c++/[x]/\n" +
+		"/c++/[x]/^/libs/b b\n" +
+		"# /a.b/\r\n" +
+		"/a.b/^/libs/c c\r\n"
+	if err := root.CookExternals(raw); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/tree/root/src (old)/a", "/tree/root/c++/[x]/b", "/tree/root/a.b/c"}
+	if got := externalPaths(root); !sameStrings(got, want) {
+		t.Errorf("cooked %q, want %q", got, want)
+	}
+
+	for line, want := range map[string]string{"# /a+b/\n": "/a+b/", "# /x\r\n": "/x", "#/x\n": "", "/x\n": ""} {
+		if got, ok := externalsHeader(line); got != want || ok != (want != "") {
+			t.Errorf("header of %q is %q, %v", line, got, ok)
+		}
+	}
+}
+
+func TestTraceCmd(t *testing.T) {
+	got := captureOutput(t, &os.Stderr, func() {
+		traceCmd("/tree/root", []string{"GIT_DIR=/a b"}, []string{"git", "log", "--format=%h $x", ""})
+	})
+	want := `+ (/tree/root) "GIT_DIR=/a b" git log "--format=%h $x" ""` + "\n"
+	if got != want {
+		t.Errorf("trace is %q, want %q", got, want)
+	}
+
+	defer func() { traceCmds = false }()
+	traceCmds = true
+	got = captureOutput(t, &os.Stderr, func() {
+		newCmd("/tree/root", nil, "git", "status")
+	})
+	if !strings.HasSuffix(got, " git status\n") {
+		t.Errorf("newCmd traced %q", got)
+	}
+}
+
+func TestCleanNestedRepos(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	dir := t.TempDir()
+	root := &Repo{Path: dir}
+	root.LinkRoot()
+	root.Externals = []Repo{{Path: filepath.Join(dir, "libs", "b"), Root: root}}
+	ext := &root.Externals[0]
+	for _, p := range []string{dir, ext.Path, filepath.Join(dir, "helper")} {
+		if err := os.MkdirAll(p, 0770); err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, p, "init", "-q")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "junk"), nil, 0660); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { dryRun, forceNested = false, false }()
+	warnings := captureOutput(t, &os.Stderr, func() {
+		if err := root.Clean(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if !strings.Contains(warnings, "Skipping "+filepath.Join(dir, "helper")) {
+		t.Errorf("no warning about the nested repo in %q", warnings)
+	}
+	if strings.Contains(warnings, "Skipping "+ext.Path) {
+		t.Errorf("warned about the external in %q", warnings)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "junk")); err == nil || !IsDir(filepath.Join(dir, "helper")) {
+		t.Error("clean should remove junk and keep helper")
+	}
+
+	forceNested = true
+	if err := root.Clean(); err != nil {
+		t.Fatal(err)
+	}
+	if IsDir(filepath.Join(dir, "helper")) || !IsDir(filepath.Join(ext.Path, ".git")) {
+		t.Error("-force-nested should remove helper and keep the external")
+	}
+}
+
+func TestGlobalArgs(t *testing.T) {
+	flags := flag.NewFlagSet("gish", flag.ContinueOnError)
+	flags.Int("j", 1, "")
+	flags.Bool("v", false, "")
+	flags.String("config", "", "")
+	for _, c := range []struct{ in, want string }{
+		{"-j4 log --oneline", "-j=4 log --oneline"},
+		{"--j8 -v status", "--j=8 -v status"},
+		{"-j 4 -config x foreach -j2", "-j 4 -config x foreach -j2"},
+		{"-v -- -j4", "-v -- -j4"},
+		{"-j=2 fetch", "-j=2 fetch"},
+	} {
+		got := strings.Join(globalArgs(flags, strings.Fields(c.in)), " ")
+		if got != c.want {
+			t.Errorf("args of %q are %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestCleanKeepsIgnored(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	dir := t.TempDir()
+	root := &Repo{Path: dir}
+	root.LinkRoot()
+	runGit(t, dir, "init", "-q")
+	files := map[string]string{
+		".git/info/exclude": "*.o\n",
+		"build.o":           "",
+		"junk":              "",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	defer func() { dryRun = false }()
+	dryRun = true
+	var out string
+	captureOutput(t, &os.Stderr, func() {
+		out = captureStdout(t, func() {
+			if err := root.Clean(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	})
+	if out != "Would remove junk\n" || !exists("junk") {
+		t.Errorf("-n printed %q", out)
+	}
+
+	dryRun = false
+	captureOutput(t, &os.Stderr, func() {
+		captureStdout(t, func() {
+			if err := root.Clean(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	})
+	if exists("junk") || !exists("build.o") {
+		t.Error("clean should remove junk and keep the ignored build.o")
+	}
+}
+
+func TestCloneTarget(t *testing.T) {
+	for _, c := range []struct{ in, parent, dir string }{
+		{"/tree/root/libs/b", "/tree/root/libs", "b"},
+		{"/tree/root/libs/b/", "/tree/root/libs", "b"},
+		{"/tree/root//libs/./b", "/tree/root/libs", "b"},
+		{"/b", "/", "b"},
+		{"b", ".", "b"},
+	} {
+		parent, dir, err := cloneTarget(c.in)
+		if err != nil || parent != c.parent || dir != c.dir {
+			t.Errorf("%q split into %q, %q, %v", c.in, parent, dir, err)
+		}
+	}
+	for _, bad := range []string{"/", ".", "..", "/tree/.."} {
+		if _, _, err := cloneTarget(bad); err == nil {
+			t.Errorf("cloning into %q wasn't an error", bad)
+		}
+	}
+}
+
+func TestWriteConfigKeepsLargerTree(t *testing.T) {
+	useMemFS(t)
+	makeRepo(t, "/tree/root")
+	if err := testTree().WriteConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	empty := &Repo{Path: "/tree/root", Url: "https://svn.example.com/repo/trunk"}
+	empty.LinkRoot()
+	warning := captureOutput(t, &os.Stderr, func() {
+		if err := empty.WriteConfig(); err == nil {
+			t.Error("an empty tree replaced the stored one")
+		}
+	})
+	if !strings.Contains(warning, "-force") {
+		t.Errorf("the warning %q doesn't mention -force", warning)
+	}
+	if n := storedRepoCount(empty.ConfigPath()); n != 4 {
+		t.Fatalf("stored config has %d repos, want 4", n)
+	}
+
+	defer func() { forceConfig = false }()
+	forceConfig = true
+	if err := empty.WriteConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if n := storedRepoCount(empty.ConfigPath()); n != 1 {
+		t.Errorf("stored config has %d repos with -force, want 1", n)
+	}
+
+	forceConfig = false
+	if err := testTree().WriteConfig(); err != nil {
+		t.Fatal(err)
+	}
+	empty.shrinkOK = true
+	if err := empty.WriteConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if n := storedRepoCount(empty.ConfigPath()); n != 1 {
+		t.Errorf("stored config has %d repos after an intended shrink, want 1", n)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	hooksRelPath = ".git/info/gish-hooks" // default hooks dir of the root repo
+	hooksPathKey = "gish.hooksPath"       // git config of the root repo naming another hooks dir
+)
+
+// Return the directory holding the hooks of the root repo at rootPath.
+func hooksDir(rootPath string) string {
+	out, err := execCmdCapture(rootPath, "git", "config", "--get", hooksPathKey)
+	dir := strings.TrimSpace(string(out))
+	if err != nil || dir == "" {
+		return path.Join(rootPath, hooksRelPath)
+	}
+	if !filepath.IsAbs(dir) {
+		dir = path.Join(rootPath, dir)
+	}
+	return dir
+}
+
+// Run the hook named name ("pre" or "post") of the root repo for the gish
+// command cmdName, if the hook exists. Like git's hooks, it gets the command
+// and the root path as arguments, and in GISH_COMMAND and GISH_ROOT. The post
+// hook also gets GISH_STATUS, 0 if the command succeeded and 1 if not.
+func (repo *Repo) runHook(name, cmdName string, cmdErr error) error {
+	rootPath := repo.Root.Path
+	hook := path.Join(hooksDir(rootPath), name)
+	if _, err := os.Stat(hook); err != nil {
+		return nil
+	}
+
+	env := []string{"GISH_HOOK=" + name, "GISH_COMMAND=" + cmdName, "GISH_ROOT=" + rootPath}
+	if name == "post" {
+		status := "0"
+		if cmdErr != nil {
+			status = "1"
+		}
+		env = append(env, "GISH_STATUS="+status)
+	}
+
+	cmd := newCmd(rootPath, env, hook, cmdName, rootPath)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	logDone := teeCmdToLog(cmd)
+	err := cmd.Run()
+	logDone(err)
+	if err != nil {
+		return fmt.Errorf("%s hook %s failed: %v", name, hook, err)
+	}
+	return nil
+}
+
+// Run the pre hook for cmdName. Its failure is the reason the command isn't run.
+func (repo *Repo) runPreHook(cmdName string) error {
+	if err := repo.runHook("pre", cmdName, nil); err != nil {
+		return fmt.Errorf("Not running %s: %v", cmdName, err)
+	}
+	return nil
+}
+
+// Run the post hook for cmdName, reporting its failure without changing the
+// command's result.
+func (repo *Repo) runPostHook(cmdName string, cmdErr error) {
+	if err := repo.runHook("post", cmdName, cmdErr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
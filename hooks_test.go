@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Install pre and post hooks in the root that append what they're run with
+// to the returned log file.
+func logHooks(t *testing.T, rootPath string) string {
+	log := filepath.Join(t.TempDir(), "hooks.log")
+	dir := filepath.Join(rootPath, hooksRelPath)
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\necho \"$GISH_HOOK $1 $2 [$GISH_STATUS] $PWD\" >> " + log + "\n"
+	for _, name := range []string{"pre", "post"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return log
+}
+
+func readLog(t *testing.T, log string) []string {
+	b, err := os.ReadFile(log)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+func TestHooks(t *testing.T) {
+	root := diskTree(t)
+	fakeGit(t, "exit 1") // No gish.hooksPath
+	log := logHooks(t, root.Path)
+
+	if err := root.runPreHook("fetch"); err != nil {
+		t.Fatal(err)
+	}
+	root.Externals[0].runPostHook("fetch", errors.New("failed"))
+	want := []string{
+		"pre fetch " + root.Path + " [] " + root.Path,
+		"post fetch " + root.Path + " [1] " + root.Path,
+	}
+	if got := readLog(t, log); !sameStrings(got, want) {
+		t.Errorf("hooks ran as\n%q\nwant\n%q", got, want)
+	}
+
+	if err := os.WriteFile(filepath.Join(root.Path, hooksRelPath, "pre"), []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.runPreHook("fetch"); err == nil || !strings.HasPrefix(err.Error(), "Not running fetch") {
+		t.Errorf("a failing pre hook returned %v", err)
+	}
+}
+
+func TestRelocateHooks(t *testing.T) {
+	root := diskTree(t)
+	fakeGit(t, "exit 1")
+	if err := root.WriteConfig(); err != nil {
+		t.Fatal(err)
+	}
+	log := logHooks(t, root.Path)
+	newRoot := filepath.Join(t.TempDir(), "moved")
+
+	t.Chdir(root.Path)
+	var err error
+	captureStdout(t, func() { err = cmdRelocate([]string{"relocate", newRoot}, nil) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"pre relocate " + root.Path + " [] " + root.Path,
+		"post relocate " + newRoot + " [0] " + newRoot,
+	}
+	if got := readLog(t, log); !sameStrings(got, want) {
+		t.Errorf("hooks ran as\n%q\nwant\n%q", got, want)
+	}
+}
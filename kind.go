@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Kinds of checked out repo, stored in Repo.Kind.
+const (
+	KindGitSvn = "git-svn" // Cloned from svn with git-svn
+	KindGit    = "git"     // A plain git repo, e.g. a mirror of the external
+)
+
+// Return the kind of the repo checked out at repoPath, "" if there is none.
+func detectKind(repoPath string) string {
+	if !IsRepo(repoPath) {
+		return ""
+	}
+	if isGitSvn(repoPath) || svnInitialized(repoPath) {
+		return KindGitSvn
+	}
+	return KindGit
+}
+
+// Set the Kind of each repo in the tree that is checked out. Repos that
+// aren't keep the kind in the config.
+func (repo *Repo) DetectKinds() {
+	for _, r := range repo.Repos() {
+		if kind := detectKind(r.Path); kind != "" {
+			r.Kind = kind
+		}
+	}
+}
+
+// Select the repos that svn commands can run in, noting those skipped.
+func gitSvnOnly(repos []*Repo) []*Repo {
+	for _, r := range repos {
+		if r.Kind == KindGit {
+			fmt.Printf("Repo %s: plain git repo, skipping svn command.\n", r.Label())
+		}
+	}
+	return svnCapable(repos)
+}
+
+// Select the repos that svn commands can run in.
+func svnCapable(repos []*Repo) []*Repo {
+	var selected []*Repo
+	for _, r := range repos {
+		if r.Kind != KindGit {
+			selected = append(selected, r)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectKinds(t *testing.T) {
+	root := diskTree(t)
+	if err := os.MkdirAll(filepath.Join(root.Path, ".git", "svn"), 0770); err != nil {
+		t.Fatal(err)
+	}
+	a := &root.Externals[1]
+	if err := os.RemoveAll(filepath.Join(a.Path, ".git")); err != nil {
+		t.Fatal(err)
+	}
+	a.Kind = KindGit
+	// Only libs/a/inner has had git svn init run in it.
+	fakeGit(t, `case "$PWD" in */inner) echo svn://other.example.com/inner;; *) exit 1;; esac`)
+
+	root.DetectKinds()
+	for _, c := range []struct {
+		r    *Repo
+		kind string
+	}{
+		{root, KindGitSvn},
+		{&root.Externals[0], KindGit},
+		{a, KindGit},
+		{&a.Externals[0], KindGitSvn},
+	} {
+		if c.r.Kind != c.kind {
+			t.Errorf("%s is %q, want %q", c.r.Path, c.r.Kind, c.kind)
+		}
+	}
+
+	var selected []*Repo
+	captureStdout(t, func() { selected = gitSvnOnly(root.Repos()) })
+	if got := repoPaths(selected); !sameStrings(got, []string{root.Path, a.Externals[0].Path}) {
+		t.Errorf("svn commands run in %q", got)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"path"
+	"strings"
+	"sync"
+)
+
+var fullPath bool // headers name repos by full path rather than label
+
+// Return a short label for each path: its last segment, with parent segments
+// added until it differs from the labels of the other paths.
+func repoLabels(paths []string) map[string]string {
+	segments := make(map[string][]string, len(paths))
+	depth := make(map[string]int, len(paths))
+	for _, p := range paths {
+		segments[p] = strings.Split(strings.Trim(path.Clean(p), "/"), "/")
+		depth[p] = 1
+	}
+	label := func(p string) string {
+		s := segments[p]
+		n := depth[p]
+		if n > len(s) {
+			n = len(s)
+		}
+		return strings.Join(s[len(s)-n:], "/")
+	}
+
+	for {
+		byLabel := make(map[string][]string)
+		for _, p := range paths {
+			byLabel[label(p)] = append(byLabel[label(p)], p)
+		}
+		grew := false
+		for _, same := range byLabel {
+			if len(same) < 2 {
+				continue
+			}
+			for _, p := range same {
+				if depth[p] < len(segments[p]) {
+					depth[p]++
+					grew = true
+				}
+			}
+		}
+		if !grew {
+			break
+		}
+	}
+
+	labels := make(map[string]string, len(paths))
+	for _, p := range paths {
+		labels[p] = label(p)
+	}
+	return labels
+}
+
+// Labels of the repos in the tree last labelled.
+var labelCache struct {
+	sync.Mutex
+	labels map[string]string
+}
+
+// Return the short label naming the repo in output, or its path with
+// -full-path.
+func (repo *Repo) Label() string {
+	if fullPath || repo.Root == nil {
+		return repo.Path
+	}
+
+	labelCache.Lock()
+	defer labelCache.Unlock()
+	if l, ok := labelCache.labels[repo.Path]; ok {
+		return l
+	}
+	var paths []string
+	for _, r := range repo.Root.Repos() {
+		paths = append(paths, r.Path)
+	}
+	labelCache.labels = repoLabels(paths)
+	if l, ok := labelCache.labels[repo.Path]; ok {
+		return l
+	}
+	return repo.Path
+}
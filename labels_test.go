@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRepoLabels(t *testing.T) {
+	want := map[string]string{
+		"/tree/root":             "tree/root",
+		"/tree/root/libs/a":      "libs/a",
+		"/tree/root/vendor/a":    "vendor/a",
+		"/tree/root/x/common/c":  "x/common/c",
+		"/tree/root/y/common/c":  "y/common/c",
+		"/tree/root/libs/b":      "b",
+		"/tree/root/libs/a/root": "a/root",
+	}
+	var paths []string
+	for p := range want {
+		paths = append(paths, p)
+	}
+	got := repoLabels(paths)
+	for p, l := range want {
+		if got[p] != l {
+			t.Errorf("%s is labelled %q, want %q", p, got[p], l)
+		}
+	}
+}
+
+func TestLabelFullPath(t *testing.T) {
+	root := testTree()
+	b := &root.Externals[0]
+	defer func() { fullPath = false }()
+	fullPath = true
+	if got := b.Label(); got != b.Path {
+		t.Errorf("-full-path labelled %s %q", b.Path, got)
+	}
+	fullPath = false
+	if got := (&Repo{Path: "/elsewhere/x"}).Label(); got != "/elsewhere/x" {
+		t.Errorf("a repo outside a tree is labelled %q", got)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// A Lock is held on the root repo of a tree while a command modifies it, so
+// concurrent gish invocations don't interleave clones or config writes.
+type Lock struct {
+	path string
+	done chan struct{}
+}
+
+// Take the lock of the tree, failing if another gish holds it. A lock left by
+// a process that no longer exists is taken over.
+func (repo *Repo) Lock() (*Lock, error) {
+	lockPath := path.Join(repo.Root.Path, lockRelPath)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			fmt.Fprintln(f, os.Getpid())
+			f.Close()
+			break
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("Can't lock %s: %v", repo.Root.Path, err)
+		}
+
+		pid, alive := lockOwner(lockPath)
+		if alive {
+			return nil, fmt.Errorf("%s is locked by another gish (pid %d). If it isn't running, remove %s",
+				repo.Root.Path, pid, lockPath)
+		}
+		if err := os.Remove(lockPath); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("Can't remove stale lock %s: %v", lockPath, err)
+		}
+	}
+
+	l := &Lock{path: lockPath, done: make(chan struct{})}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigs:
+			os.Remove(l.path)
+			fmt.Fprintf(os.Stderr, "gish: %v\n", sig)
+			os.Exit(1)
+		case <-l.done:
+			signal.Stop(sigs)
+		}
+	}()
+	return l, nil
+}
+
+// Release the lock.
+func (l *Lock) Unlock() {
+	close(l.done)
+	os.Remove(l.path)
+}
+
+// Return the pid stored in a lockfile and whether that process is still
+// running. An unreadable lockfile is assumed to be held, as it may be being
+// written.
+func lockOwner(lockPath string) (int, bool) {
+	data, err := ioutil.ReadFile(lockPath)
+	if err != nil {
+		return 0, !os.IsNotExist(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, true
+	}
+
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return pid, false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return pid, !(errors.Is(err, os.ErrProcessDone) || errors.Is(err, syscall.ESRCH))
+}
+
+// Follow the tree to newRoot after it has been moved.
+func (l *Lock) Moved(newRoot string) {
+	l.path = path.Join(newRoot, lockRelPath)
+}
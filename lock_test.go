@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestLock(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ".git", "info"), 0770); err != nil {
+		t.Fatal(err)
+	}
+	root := &Repo{Path: dir}
+	root.LinkRoot()
+
+	l, err := root.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := root.Lock(); err == nil {
+		t.Error("took the lock twice")
+	}
+	l.Unlock()
+	lockPath := filepath.Join(dir, lockRelPath)
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("the lockfile is left after unlocking: %v", err)
+	}
+
+	// A lock left by a process that has exited is taken over.
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip("can't run true:", err)
+	}
+	if err := os.WriteFile(lockPath, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l, err = root.Lock()
+	if err != nil {
+		t.Fatalf("a stale lock wasn't taken over: %v", err)
+	}
+	l.Unlock()
+}
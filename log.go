@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+var logFile string // Path of the -log-file, "" for none
+
+// The log of the commands gish runs and their output, nil if not logging.
+// Writes are serialized so concurrent commands don't interleave mid-line.
+var cmdLog *lockedWriter
+
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// Open the command log, appending to it if it exists.
+func openCmdLog(name string) error {
+	if name == "" {
+		return nil
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("Can't open log file: %v", err)
+	}
+	cmdLog = &lockedWriter{w: f}
+	return nil
+}
+
+// Return the line that introduces a command in the log.
+func logHeader(cmd *exec.Cmd) string {
+	return fmt.Sprintf("[%s] Repo %s: %s\n", time.Now().Format(time.RFC3339),
+		cmd.Dir, strings.Join(cmd.Args, " "))
+}
+
+// Log a command that has run, with its captured output.
+func logCmdOutput(cmd *exec.Cmd, out []byte, err error) {
+	if cmdLog == nil {
+		return
+	}
+	entry := logHeader(cmd) + string(out)
+	if len(out) > 0 && out[len(out)-1] != '\n' {
+		entry += "\n"
+	}
+	if err != nil {
+		entry += fmt.Sprintf("Command returned error: %v\n", err)
+	}
+	cmdLog.Write([]byte(entry))
+}
+
+// Copy the output of a command that is about to run to the log as well as
+// where it already goes. Call the returned func with the command's error
+// once it has finished.
+func teeCmdToLog(cmd *exec.Cmd) (done func(error)) {
+	if cmdLog == nil {
+		return func(error) {}
+	}
+	cmdLog.Write([]byte(logHeader(cmd)))
+	cmd.Stdout = io.MultiWriter(cmd.Stdout, cmdLog)
+	cmd.Stderr = io.MultiWriter(cmd.Stderr, cmdLog)
+	return func(err error) {
+		if err != nil {
+			fmt.Fprintf(cmdLog, "Command returned error: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCmdLog(t *testing.T) {
+	root := diskTree(t)
+	fakeGit(t, `case "$PWD" in */libs/b) echo 'broken' >&2; exit 1;; esac; echo "output"`)
+	name := filepath.Join(t.TempDir(), "gish.log")
+	if err := openCmdLog(name); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { cmdLog = nil; jobs = 1 }()
+
+	for _, jobs = range []int{1, 4} {
+		captureStdout(t, func() { Foreach(root.Repos(), []string{"log", "-1"}) })
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := string(b)
+	for _, r := range root.Repos() {
+		if n := strings.Count(log, "Repo "+r.Path+": git log -1\n"); n != 2 {
+			t.Errorf("%s is logged %d times:\n%s", r.Path, n, log)
+		}
+	}
+	if strings.Count(log, "output\n") != 6 || strings.Count(log, "broken\nCommand returned error: exit status 1\n") != 2 {
+		t.Errorf("the output isn't logged:\n%s", log)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	manifestDirKey = "gish.manifestDir" // git config of the root repo naming its manifest dir
+	manifestName   = "gish.conf"
+)
+
+// Return the manifest directory of the root repo at rootPath, "" if it has
+// none. The manifest is a copy of the config kept outside the repo, e.g. to be
+// versioned on its own.
+func manifestDirOf(rootPath string) string {
+	out, err := execCmdCapture(rootPath, "git", "config", "--get", manifestDirKey)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// Keep a manifest of the root repo at rootPath in dir.
+func setManifestDir(rootPath, dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	err = fsys.MkdirAll(abs, 0770)
+	if err != nil {
+		return err
+	}
+	_, err = execCmdCapture(rootPath, "git", "config", manifestDirKey, abs)
+	if err != nil {
+		return fmt.Errorf("Can't set the manifest dir of %s: %v", rootPath, err)
+	}
+	return nil
+}
+
+// Write the config to the manifest dir too, if the root has one.
+func (repo *Repo) writeManifest(config []byte) error {
+	dir := manifestDirOf(repo.Path)
+	if dir == "" {
+		return nil
+	}
+	return fsys.WriteFile(path.Join(dir, manifestName), config, 0660)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestDir(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	root := testTree()
+	RewritePaths(root, "/tree/root", t.TempDir())
+	runGit(t, root.Path, "init", "-q")
+	if manifestDirOf(root.Path) != "" {
+		t.Error("a new repo has a manifest dir")
+	}
+
+	dir := filepath.Join(t.TempDir(), "manifests")
+	if err := setManifestDir(root.Path, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.WriteConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, manifestName)); err != nil {
+		t.Errorf("no manifest: %v", err)
+	}
+
+	// The manifest is read when the repo's config is gone.
+	if err := os.Remove(root.ConfigPath()); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadConfig(root.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Repos()) != len(root.Repos()) {
+		t.Errorf("loaded %d repos from the manifest", len(loaded.Repos()))
+	}
+}
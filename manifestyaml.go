@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Portable manifests can be written as YAML for editing by hand. Only the
+// subset of YAML needed for the manifest is written and read: block mappings
+// and sequences of them, with scalars that are double quoted strings,
+// booleans or integers.
+
+const (
+	manifestJSON = "json"
+	manifestYAML = "yaml"
+)
+
+// Return the manifest format for a file, from format if it's given and
+// otherwise from the file's extension. JSON is the default.
+func manifestFormat(format, file string) (string, error) {
+	switch format {
+	case manifestJSON, manifestYAML:
+		return format, nil
+	case "":
+	default:
+		return "", fmt.Errorf("Unknown manifest format %q, use json or yaml", format)
+	}
+	switch strings.ToLower(path.Ext(file)) {
+	case ".yaml", ".yml":
+		return manifestYAML, nil
+	}
+	return manifestJSON, nil
+}
+
+func marshalManifestYAML(m *portableManifest) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Version: %d\n", m.Version)
+	b.WriteString("Tree:\n")
+	writeRepoYAML(&b, &m.Tree, "  ", "  ")
+	return b.Bytes()
+}
+
+// Write the fields of p, the first line starting with first and the rest
+// with indent, so p can be an item of a sequence.
+func writeRepoYAML(b *bytes.Buffer, p *portableRepo, first, indent string) {
+	prefix := first
+	field := func(key, value string) {
+		if value != "" {
+			value = " " + value
+		}
+		fmt.Fprintf(b, "%s%s:%s\n", prefix, key, value)
+		prefix = indent
+	}
+	if p.Path != "" {
+		field("Path", strconv.Quote(p.Path))
+	}
+	field("Url", strconv.Quote(p.Url))
+	if p.Rev != "" {
+		field("Rev", strconv.Quote(p.Rev))
+	}
+	field("ExternalsKnown", strconv.FormatBool(p.ExternalsKnown))
+	if len(p.Externals) > 0 {
+		field("Externals", "")
+		for i := range p.Externals {
+			writeRepoYAML(b, &p.Externals[i], indent+"  - ", indent+"    ")
+		}
+	}
+}
+
+// A line of YAML. An item of a sequence is a dash line followed by its
+// mapping, indented past the dash.
+type yamlLine struct {
+	n      int // Line number, for errors
+	indent int
+	dash   bool
+	key    string
+	value  string
+}
+
+func splitYAML(b []byte) ([]yamlLine, error) {
+	var lines []yamlLine
+	for n, text := range strings.Split(string(b), "\n") {
+		content := strings.TrimLeft(text, " ")
+		if content == "" || strings.HasPrefix(content, "#") {
+			continue
+		}
+		indent := len(text) - len(content)
+		for strings.HasPrefix(content, "- ") {
+			lines = append(lines, yamlLine{n: n + 1, indent: indent, dash: true})
+			content = strings.TrimLeft(content[2:], " ")
+			indent = len(text) - len(content)
+		}
+		colon := strings.Index(content, ":")
+		if colon < 0 {
+			return nil, fmt.Errorf("line %d: expected 'key: value'", n+1)
+		}
+		lines = append(lines, yamlLine{n: n + 1, indent: indent,
+			key: content[:colon], value: strings.TrimSpace(content[colon+1:])})
+	}
+	return lines, nil
+}
+
+func yamlString(l yamlLine) (string, error) {
+	if strings.HasPrefix(l.value, `"`) {
+		s, err := strconv.Unquote(l.value)
+		if err != nil {
+			return "", fmt.Errorf("line %d: bad string %s", l.n, l.value)
+		}
+		return s, nil
+	}
+	return l.value, nil
+}
+
+func unmarshalManifestYAML(b []byte, m *portableManifest) error {
+	lines, err := splitYAML(b)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(lines); {
+		l := lines[i]
+		if l.indent != 0 || l.dash {
+			return fmt.Errorf("line %d: unexpected indentation", l.n)
+		}
+		i++
+		switch l.key {
+		case "Version":
+			m.Version, err = strconv.Atoi(l.value)
+			if err != nil {
+				return fmt.Errorf("line %d: bad version %q", l.n, l.value)
+			}
+		case "Tree":
+			if i == len(lines) || lines[i].indent == 0 {
+				return fmt.Errorf("line %d: Tree is empty", l.n)
+			}
+			i, err = parseRepoYAML(lines, i, lines[i].indent, &m.Tree)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("line %d: unknown key %q", l.n, l.key)
+		}
+	}
+	return nil
+}
+
+// Parse the mapping at lines[i:] indented by indent into p, returning the
+// index of the line after it.
+func parseRepoYAML(lines []yamlLine, i, indent int, p *portableRepo) (int, error) {
+	var err error
+	for i < len(lines) && lines[i].indent >= indent {
+		l := lines[i]
+		if l.indent > indent || l.dash {
+			return i, fmt.Errorf("line %d: unexpected indentation", l.n)
+		}
+		i++
+		switch l.key {
+		case "Path":
+			p.Path, err = yamlString(l)
+		case "Url":
+			p.Url, err = yamlString(l)
+		case "Rev":
+			p.Rev, err = yamlString(l)
+		case "ExternalsKnown":
+			p.ExternalsKnown, err = strconv.ParseBool(l.value)
+			if err != nil {
+				err = fmt.Errorf("line %d: bad boolean %q", l.n, l.value)
+			}
+		case "Externals":
+			for i < len(lines) && lines[i].dash && lines[i].indent >= indent {
+				dash := lines[i]
+				i++
+				if i == len(lines) || lines[i].indent <= dash.indent {
+					return i, fmt.Errorf("line %d: empty external", dash.n)
+				}
+				var ext portableRepo
+				i, err = parseRepoYAML(lines, i, lines[i].indent, &ext)
+				if err != nil {
+					return i, err
+				}
+				p.Externals = append(p.Externals, ext)
+			}
+		default:
+			err = fmt.Errorf("line %d: unknown key %q", l.n, l.key)
+		}
+		if err != nil {
+			return i, err
+		}
+	}
+	return i, nil
+}
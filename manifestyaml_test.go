@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestManifestYAMLRoundTrip(t *testing.T) {
+	m := &portableManifest{Version: 1, Tree: portableRepo{
+		Url:            "https://svn.example.com/repo/trunk",
+		ExternalsKnown: true,
+		Externals: []portableRepo{
+			{Path: "libs/a", Url: "svn://other.example.com/a b", Rev: "12", ExternalsKnown: true,
+				Externals: []portableRepo{{Path: "inner", Url: "svn://other.example.com/\"q\""}}},
+			{Path: "libs/b", Url: "https://svn.example.com/repo/libs/b"},
+		},
+	}}
+
+	b := marshalManifestYAML(m)
+	var got portableManifest
+	if err := unmarshalManifestYAML(b, &got); err != nil {
+		t.Fatalf("%v in\n%s", err, b)
+	}
+	if !reflect.DeepEqual(&got, m) {
+		t.Errorf("round trip gave %+v, want %+v, from\n%s", got, *m, b)
+	}
+}
+
+func TestUnmarshalManifestYAMLErrors(t *testing.T) {
+	for _, doc := range []string{
+		"Version: x\n",
+		"Tree:\n",
+		"Colour: red\n",
+		"Tree:\n  Url: \"u\"\n  Externals:\n    -\n",
+		"Tree:\n  Url: \"u\n",
+		"Tree:\n  ExternalsKnown: maybe\n",
+	} {
+		var m portableManifest
+		if err := unmarshalManifestYAML([]byte(doc), &m); err == nil {
+			t.Errorf("no error for %q", doc)
+		} else if !strings.HasPrefix(err.Error(), "line ") {
+			t.Errorf("error %q for %q doesn't give the line", err, doc)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Report whether dir is a bare git repo.
+func isBareRepo(dir string) bool {
+	if IsRepo(dir) {
+		return false
+	}
+	out, err := execCmdCapture(dir, "git", "rev-parse", "--is-bare-repository")
+	return err == nil && string(bytes.TrimSpace(out)) == "true"
+}
+
+// Push the root repo, including its svn remotes, to a bare repo at dest and
+// store the config there, so the tree can be shared without svn access for
+// the root. An existing mirror is updated. The stored config is read back to
+// check it matches the tree.
+func (repo *Repo) Mirror(dest string) error {
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+
+	if IsDir(dest) {
+		if !isBareRepo(dest) {
+			return fmt.Errorf("%s exists and isn't a bare git repo", dest)
+		}
+		fmt.Printf("Updating mirror %s\n", dest)
+	} else {
+		err = execCmd(repo.Path, "git", "init", "--bare", dest)
+		if err != nil {
+			return fmt.Errorf("Can't create mirror %s: %v", dest, err)
+		}
+	}
+
+	err = execCmd(repo.Path, "git", "push", "--mirror", dest)
+	if err != nil {
+		return fmt.Errorf("Can't push to mirror %s: %v", dest, err)
+	}
+
+	config, err := repo.MarshalConfig()
+	if err != nil {
+		return err
+	}
+	err = fsys.WriteFile(path.Join(dest, bareCachePath), config, 0644)
+	if err != nil {
+		return err
+	}
+
+	mirrored, err := LoadConfig(dest)
+	if err != nil {
+		return fmt.Errorf("Mirror config can't be read back: %v", err)
+	}
+	stored, err := mirrored.MarshalConfig()
+	if err != nil || !bytes.Equal(stored, config) {
+		return fmt.Errorf("Mirror config in %s doesn't match the tree", dest)
+	}
+	return nil
+}
+
+func cmdMirror(args []string, repo *Repo) error {
+	flags := flag.NewFlagSet("mirror", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish mirror <destBare>\n")
+		fmt.Fprint(os.Stderr, "\nCreate or update a bare mirror of the root repo that carries the gish config.\n")
+	}
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return &UsageError{flags.Usage, "mirror needs the path of the bare repo."}
+	}
+
+	return repo.Mirror(flags.Arg(0))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Run git in dir for setting up a test, failing the test if it fails.
+func runGit(t *testing.T, dir string, args ...string) {
+	args = append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %q: %v\n%s", args, err, out)
+	}
+}
+
+func TestMirror(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	root := testTree()
+	RewritePaths(root, "/tree/root", t.TempDir())
+	runGit(t, root.Path, "init", "-q")
+	runGit(t, root.Path, "commit", "-q", "--allow-empty", "-m", "first")
+
+	dest := filepath.Join(t.TempDir(), "mirror.git")
+	for i := 0; i < 2; i++ {
+		if err := root.Mirror(dest); err != nil {
+			t.Fatalf("mirror %d: %v", i, err)
+		}
+	}
+	if !isBareRepo(dest) {
+		t.Errorf("%s isn't a bare repo", dest)
+	}
+	mirrored, err := LoadConfig(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mirrored.Repos()) != len(root.Repos()) {
+		t.Errorf("the mirror has %d repos", len(mirrored.Repos()))
+	}
+
+	if err := root.Mirror(root.Path); err == nil {
+		t.Error("mirrored over a directory that isn't a bare repo")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Version of the portable manifest format. Bump it when the fields change.
+const portableVersion = 1
+
+// A portable manifest describes a tree with paths relative to its root, so
+// it can be handed to someone to clone the tree anywhere without the config.
+type portableManifest struct {
+	Version int
+	Tree    portableRepo
+}
+
+type portableRepo struct {
+	Path           string `json:",omitempty"` // Relative to the root, empty for the root
+	Url            string
+	Rev            string `json:",omitempty"`
+	ExternalsKnown bool
+	Externals      []portableRepo `json:",omitempty"`
+}
+
+func toPortable(r *Repo, rootPath string) portableRepo {
+	p := portableRepo{Url: r.Url, Rev: r.Rev, ExternalsKnown: r.ExternalsKnown}
+	if r.Path != rootPath {
+		p.Path = strings.TrimPrefix(r.Path, rootPath+"/")
+	}
+	for i := range r.Externals {
+		p.Externals = append(p.Externals, toPortable(&r.Externals[i], rootPath))
+	}
+	return p
+}
+
+func fromPortable(p portableRepo, rootPath string) (Repo, error) {
+	r := Repo{Path: rootPath, Url: p.Url, Rev: p.Rev, ExternalsKnown: p.ExternalsKnown}
+	if p.Path != "" {
+		if err := checkRemapPath(p.Path); err != nil {
+			return r, fmt.Errorf("Bad manifest path: %v", err)
+		}
+		r.Path = path.Join(rootPath, p.Path)
+	}
+	for _, pe := range p.Externals {
+		ext, err := fromPortable(pe, rootPath)
+		if err != nil {
+			return r, err
+		}
+		r.Externals = append(r.Externals, ext)
+	}
+	return r, nil
+}
+
+// Return a portable manifest of the tree, in format json or yaml.
+func (repo *Repo) ExportManifest(format string) ([]byte, error) {
+	m := portableManifest{Version: portableVersion, Tree: toPortable(repo, repo.Path)}
+	if format == manifestYAML {
+		return marshalManifestYAML(&m), nil
+	}
+	b, err := json.MarshalIndent(&m, "", "  ")
+	return append(b, '\n'), err
+}
+
+// Load the tree described by a portable manifest, to be cloned at destDir.
+// The format is taken from the file's extension unless it is given.
+func ImportManifest(manifestPath, destDir, format string) (*Repo, error) {
+	format, err := manifestFormat(format, manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	b, err := fsys.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var m portableManifest
+	if format == manifestYAML {
+		err = unmarshalManifestYAML(b, &m)
+	} else {
+		err = json.Unmarshal(b, &m)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Bad manifest %s: %v", manifestPath, err)
+	}
+	if m.Version != portableVersion {
+		return nil, fmt.Errorf("Manifest %s is version %d, this gish reads version %d",
+			manifestPath, m.Version, portableVersion)
+	}
+
+	abs, err := filepath.Abs(destDir)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := fromPortable(m.Tree, abs)
+	if err != nil {
+		return nil, err
+	}
+	repo.LinkRoot()
+	return &repo, nil
+}
+
+func cmdExportManifest(args []string, repo *Repo) error {
+	var format string
+	flags := flag.NewFlagSet("export-manifest", flag.ContinueOnError)
+	flags.StringVar(&format, "manifest-format", "", "Write the manifest as json or yaml. Taken from the file's extension by default, json for stdout.")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish export-manifest [options] [file]\n")
+		fmt.Fprint(os.Stderr, "\tWrite the urls and relative paths of the tree, for 'gish clone -manifest'.\n")
+		fmt.Fprint(os.Stderr, "\tThe manifest is written to stdout if no file is given.\n")
+		fmt.Fprint(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		return &UsageError{flags.Usage, "Too many arguments."}
+	}
+
+	format, err := manifestFormat(format, flags.Arg(0))
+	if err != nil {
+		return &UsageError{flags.Usage, err.Error()}
+	}
+	b, err := repo.ExportManifest(format)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return fsys.WriteFile(flags.Arg(0), b, 0660)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExportImportManifest(t *testing.T) {
+	useMemFS(t)
+	if err := fsys.MkdirAll("/share", 0770); err != nil {
+		t.Fatal(err)
+	}
+	root := testTree()
+
+	for _, name := range []string{"/share/tree.json", "/share/tree.yaml"} {
+		format, err := manifestFormat("", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := root.ExportManifest(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), "/tree/root") {
+			t.Errorf("%s has absolute paths:\n%s", name, b)
+		}
+		if err := fsys.WriteFile(name, b, 0660); err != nil {
+			t.Fatal(err)
+		}
+
+		imported, err := ImportManifest(name, "/elsewhere/copy", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, want := imported.Repos(), root.Repos()
+		if len(got) != len(want) {
+			t.Fatalf("%s imported %d repos, want %d", name, len(got), len(want))
+		}
+		for i := range want {
+			wantPath := strings.Replace(want[i].Path, "/tree/root", "/elsewhere/copy", 1)
+			if got[i].Path != wantPath || got[i].Url != want[i].Url || got[i].Rev != want[i].Rev {
+				t.Errorf("%s: imported %s %s@%s, want %s %s@%s", name,
+					got[i].Path, got[i].Url, got[i].Rev, wantPath, want[i].Url, want[i].Rev)
+			}
+			if got[i].Root != imported {
+				t.Errorf("%s isn't linked to the root", got[i].Path)
+			}
+		}
+	}
+
+	for _, bad := range []string{
+		`{"Version": 2, "Tree": {"Url": "u"}}`,
+		`{"Version": 1, "Tree": {"Url": "u", "Externals": [{"Path": "../out", "Url": "x"}]}}`,
+		`{"Version": 1`,
+	} {
+		if err := fsys.WriteFile("/share/bad.json", []byte(bad), 0660); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ImportManifest("/share/bad.json", "/elsewhere/copy", ""); err == nil {
+			t.Errorf("imported %s", bad)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Return the directories under the repo that were once gish-managed externals
+// but are no longer in the config. An external is recognized by being in the
+// repo's record of managed externals, which IgnoreExternals adds every
+// external to, and by being a git repo itself. Directories the user created,
+// even ones excluded by hand, are never recorded, so they are left alone.
+func (repo *Repo) StaleExternals() ([]string, error) {
+	entries, err := repo.managedEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(repo.Externals))
+	for _, ext := range repo.Externals {
+		known[path.Clean(ext.Path)] = true
+	}
+
+	var stale []string
+	for _, entry := range entries {
+		p := path.Join(repo.Path, entry)
+		if known[p] || !IsRepo(p) {
+			continue
+		}
+		stale = append(stale, p)
+	}
+	return stale, nil
+}
+
+// Remove stale externals in the repo and all its externals.
+// With dryRun set the directories are only listed.
+func (repo *Repo) Prune(dryRun bool) error {
+	stale, err := repo.StaleExternals()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range stale {
+		if dryRun {
+			fmt.Printf("Would remove %q\n", p)
+			continue
+		}
+
+		fmt.Printf("Removing %q\n", p)
+		err = fsys.RemoveAll(p)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	for i := range repo.Externals {
+		err = repo.Externals[i].Prune(dryRun)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return the entries of the repo's ignore file, without blanks and comments.
+func (repo *Repo) ignoreEntries() ([]string, error) {
+	return readEntries(path.Join(gitCommonDir(repo.Path), ignoreRelPath))
+}
+
+// Return the paths, relative to the repo, of the externals gish has managed
+// in it.
+func (repo *Repo) managedEntries() ([]string, error) {
+	return readEntries(path.Join(gitCommonDir(repo.Path), managedRelPath))
+}
+
+// Return the lines of a file, without blanks and comments. A missing file
+// has none.
+func readEntries(filename string) ([]string, error) {
+	b, err := fsys.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var entries []string
+	for _, line := range strings.Split(string(b), "\n") {
+		entry := strings.TrimSpace(line)
+		if entry != "" && !strings.HasPrefix(entry, "#") {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// Add the repo's externals to its record of managed externals, so prune can
+// tell them from directories the user made once they leave the config.
+func (repo *Repo) recordManaged() {
+	entries, err := repo.managedEntries()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "IgnoreExternals:", err)
+		return
+	}
+	recorded := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		recorded[e] = true
+	}
+
+	addBuf := new(bytes.Buffer)
+	for _, ext := range repo.Externals {
+		relPath, err := filepath.Rel(repo.Path, ext.Path)
+		if err != nil || recorded[filepath.ToSlash(relPath)] {
+			continue
+		}
+		fmt.Fprintln(addBuf, filepath.ToSlash(relPath))
+	}
+	if addBuf.Len() == 0 {
+		return
+	}
+	err = appendFile(path.Join(gitCommonDir(repo.Path), managedRelPath), addBuf.Bytes(), 0666)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "IgnoreExternals:", err)
+	}
+}
+
+func cmdPrune(args []string, repo *Repo) error {
+	var pruneDryRun, pruneForce bool
+	flags := flag.NewFlagSet("prune", flag.ContinueOnError)
+	flags.BoolVar(&pruneDryRun, "n", false, "List the stale externals that would be removed.")
+	flags.BoolVar(&pruneForce, "f", false, "Remove the stale externals. -n or -f is required for prune.")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish prune [options]\n")
+		fmt.Fprint(os.Stderr, "\tRemove external directories that are no longer in the config.\n")
+		fmt.Fprint(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+
+	if len(args) < 2 {
+		return &UsageError{flags.Usage, "Not enough arguments to 'gish prune'."}
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+
+	if !pruneForce && !pruneDryRun {
+		return &UsageError{flags.Usage, "-n or -f required for prune."}
+	}
+
+	return repo.Prune(!pruneForce)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStaleExternals(t *testing.T) {
+	useMemFS(t)
+	for _, p := range []string{"/tree/root", "/tree/root/libs/a", "/tree/root/old", "/tree/root/mine"} {
+		makeRepo(t, p)
+	}
+	root := &Repo{Path: "/tree/root", Url: "u", Externals: []Repo{{Path: "/tree/root/libs/a", Url: "a"}}}
+	root.LinkRoot()
+	root.IgnoreExternals()
+
+	// old was an external and gone is one whose checkout was removed, while
+	// mine is the user's own repo, excluded by hand.
+	if err := appendFile("/tree/root/.git/info/gish-externals", []byte("old\ngone\n"), 0660); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendFile("/tree/root/.git/info/exclude", []byte("mine\nold\n"), 0660); err != nil {
+		t.Fatal(err)
+	}
+
+	managed, err := root.managedEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(managed, " "); got != "libs/a old gone" {
+		t.Errorf("managed externals are %q", got)
+	}
+
+	stale, err := root.StaleExternals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 || stale[0] != "/tree/root/old" {
+		t.Errorf("stale externals are %q, want only /tree/root/old", stale)
+	}
+
+	if err := root.Prune(false); err != nil {
+		t.Fatal(err)
+	}
+	if IsRepo("/tree/root/old") || !IsRepo("/tree/root/mine") || !IsRepo("/tree/root/libs/a") {
+		t.Error("prune removed the wrong directories")
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// A git-svn branches mapping, such as "branches/*:refs/remotes/origin/*":
+// the svn directory holding the branches and the prefix of their refs.
+type branchSpec struct {
+	Dir, RefPrefix string
+}
+
+// Parse the value of svn-remote.svn.branches. Only a glob over a whole
+// directory of branches is understood.
+func parseBranchSpec(value string) (branchSpec, bool) {
+	parts := strings.SplitN(strings.TrimSpace(value), ":", 2)
+	if len(parts) != 2 || !strings.HasSuffix(parts[0], "/*") || !strings.HasSuffix(parts[1], "/*") ||
+		!strings.HasPrefix(parts[1], "refs/") {
+		return branchSpec{}, false
+	}
+	return branchSpec{strings.TrimSuffix(parts[0], "/*"), strings.TrimSuffix(parts[1], "*")}, true
+}
+
+// Return the refs under prefix for branches that aren't in live, the names
+// svn lists in the branches directory. git-svn's refs for old incarnations
+// of a branch, "name@rev", go with the branch. Refs in keep, such as trunk's
+// when it shares the prefix, and refs further down such as tags are left.
+func staleBranchRefs(refs []string, prefix string, live, keep map[string]bool) []string {
+	var stale []string
+	for _, ref := range refs {
+		if !strings.HasPrefix(ref, prefix) || keep[ref] {
+			continue
+		}
+		name := strings.TrimPrefix(ref, prefix)
+		if strings.Contains(name, "/") {
+			continue
+		}
+		if at := strings.LastIndex(name, "@"); at > 0 {
+			name = name[:at]
+		}
+		if !live[name] {
+			stale = append(stale, ref)
+		}
+	}
+	return stale
+}
+
+// Delete the repo's refs for svn branches that have been deleted, returning
+// the refs removed.
+func (repo *Repo) pruneBranches() ([]string, error) {
+	out, err := execCmdCapture(repo.Path, "git", "config", "--get-all", "svn-remote.svn.branches")
+	if err != nil {
+		// No branches are mapped.
+		return nil, nil
+	}
+	rootOut, err := execCmdCapture(repo.Path, "git", "config", "--get", "svn-remote.svn.url")
+	if err != nil {
+		return nil, fmt.Errorf("No svn-remote.svn.url in %s: %v", repo.Path, err)
+	}
+	svnRoot := strings.TrimSpace(string(rootOut))
+
+	// Refs fetched without a glob, such as trunk's.
+	keep := make(map[string]bool)
+	fetchOut, _ := execCmdCapture(repo.Path, "git", "config", "--get-all", "svn-remote.svn.fetch")
+	for _, value := range strings.Split(string(fetchOut), "\n") {
+		if parts := strings.SplitN(strings.TrimSpace(value), ":", 2); len(parts) == 2 {
+			keep[parts[1]] = true
+		}
+	}
+
+	var pruned []string
+	for _, value := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		spec, ok := parseBranchSpec(value)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Repo %s: can't prune branches mapped by %q\n", repo.Path, value)
+			continue
+		}
+
+		dirUrl, err := joinUrlPath(svnRoot, spec.Dir)
+		if err != nil {
+			return pruned, err
+		}
+		ls, err := execCmdEnv("", cLocale, "svn", "ls", dirUrl)
+		if err != nil {
+			return pruned, fmt.Errorf("svn ls %s failed (%s)", dirUrl, err)
+		}
+		live := make(map[string]bool)
+		for _, name := range strings.Split(string(ls), "\n") {
+			if name = strings.TrimSuffix(strings.TrimSpace(name), "/"); name != "" {
+				live[name] = true
+			}
+		}
+
+		refsOut, err := execCmdCapture(repo.Path, "git", "for-each-ref", "--format=%(refname)", spec.RefPrefix)
+		if err != nil {
+			return pruned, fmt.Errorf("git for-each-ref failed in %s: %v", repo.Path, err)
+		}
+		refs := strings.Split(strings.TrimSpace(string(refsOut)), "\n")
+		for _, ref := range staleBranchRefs(refs, spec.RefPrefix, live, keep) {
+			err := execCmd(repo.Path, "git", "update-ref", "-d", ref)
+			if err != nil {
+				return pruned, fmt.Errorf("Can't delete %s in %s: %v", ref, repo.Path, err)
+			}
+			pruned = append(pruned, ref)
+		}
+	}
+	return pruned, nil
+}
+
+// Report whether a fetch command line is meant for gish rather than git.
+func isPruneBranches(args []string) bool {
+	return len(args) > 1 && (args[1] == "--prune-branches" || args[1] == "-prune-branches")
+}
+
+// Report whether a fetch command line only asks how far behind svn the
+// repos are.
+func isFetchDryRun(args []string) bool {
+	return len(args) == 2 && (args[1] == "--dry-run" || args[1] == "-dry-run")
+}
+
+// Fetch from svn and delete the refs of svn branches deleted since, with
+// --prune-branches, or with --dry-run report how many svn revisions each repo
+// is behind, as status --fetch does. Other fetch command lines are passed to
+// git.
+func cmdFetch(args []string, repo *Repo) error {
+	if isFetchDryRun(args) {
+		return printBehind(repo.Repos())
+	}
+	if !isPruneBranches(args) {
+		return Foreach(repo.Repos(), args)
+	}
+
+	// Foreach notes the plain git repos it skips.
+	present := presentOnly(repo.Repos())
+	repos := svnCapable(present)
+	if err := checkUUIDs(repos); err != nil {
+		return err
+	}
+	err := Foreach(present, append([]string{"svn", "fetch"}, args[2:]...))
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, r := range repos {
+		pruned, err := r.pruneBranches()
+		for _, ref := range pruned {
+			fmt.Printf("Repo %s: pruned %s\n", r.Label(), ref)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("Couldn't prune the branches of %d repos", failed)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseBranchSpec(t *testing.T) {
+	for value, want := range map[string]branchSpec{
+		"branches/*:refs/remotes/origin/*":         {"branches", "refs/remotes/origin/"},
+		" proj/branches/*:refs/remotes/branches/*": {"proj/branches", "refs/remotes/branches/"},
+	} {
+		if got, ok := parseBranchSpec(value); !ok || got != want {
+			t.Errorf("%q parsed as %+v, %v", value, got, ok)
+		}
+	}
+	for _, bad := range []string{
+		"branches/{a,b}:refs/remotes/origin/*",
+		"branches/*:origin/*",
+		"branches/*",
+		"branches/*/x:refs/remotes/*",
+	} {
+		if got, ok := parseBranchSpec(bad); ok {
+			t.Errorf("%q parsed as %+v", bad, got)
+		}
+	}
+}
+
+func TestStaleBranchRefs(t *testing.T) {
+	const prefix = "refs/remotes/origin/"
+	refs := []string{
+		prefix + "live",
+		prefix + "live@120",
+		prefix + "gone",
+		prefix + "gone@99",
+		prefix + "trunk",
+		prefix + "tags/v1",
+		"refs/remotes/other/gone",
+	}
+	live := map[string]bool{"live": true}
+	keep := map[string]bool{prefix + "trunk": true}
+	got := staleBranchRefs(refs, prefix, live, keep)
+	if want := prefix + "gone " + prefix + "gone@99"; strings.Join(got, " ") != want {
+		t.Errorf("stale refs are %q, want %q", got, want)
+	}
+}
+
+func TestFetchDryRun(t *testing.T) {
+	for args, want := range map[string]bool{
+		"fetch --dry-run":       true,
+		"fetch -dry-run":        true,
+		"fetch --dry-run --all": false,
+		"fetch":                 false,
+	} {
+		if got := isFetchDryRun(strings.Fields(args)); got != want {
+			t.Errorf("isFetchDryRun(%q) is %v", args, got)
+		}
+	}
+
+	dir := t.TempDir()
+	root := &Repo{Path: dir, Url: "https://svn.example.com/repo/trunk"}
+	root.LinkRoot()
+	if err := os.MkdirAll(filepath.Join(dir, ".git", "svn"), 0770); err != nil {
+		t.Fatal(err)
+	}
+	// Only svn info is answered, anything that fetches fails.
+	fakeGit(t, `case "$1 $2" in "svn info") echo 'Last Changed Rev: 100';; *) exit 1;; esac`)
+	fakeCommand(t, "svn", `case "$1" in info) echo 'Last Changed Rev: 100';; *) exit 1;; esac`)
+	var err error
+	out := captureStdout(t, func() { err = cmdFetch([]string{"fetch", "--dry-run"}, root) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := root.Label() + ": up to date at r100\n"; out != want {
+		t.Errorf("printed %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+)
+
+// Output of git and git-svn that means a rebase stopped on a conflict.
+var rebaseConflictMarkers = [][]byte{
+	[]byte("CONFLICT ("),
+	[]byte("Resolve all conflicts manually"),
+	[]byte("could not apply"),
+	[]byte("When you have resolved this problem"),
+}
+
+// Report whether git args rebase the repo, so that a conflict leaves it
+// mid-rebase.
+func isRebaseCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "rebase", "pull":
+		return true
+	case "svn":
+		return len(args) > 1 && args[1] == "rebase"
+	}
+	return false
+}
+
+// Report whether a rebase in the repo stopped on a conflict, from the output
+// of the command or the state it left behind.
+func rebaseConflicted(repoPath string, out []byte) bool {
+	for _, marker := range rebaseConflictMarkers {
+		if bytes.Contains(out, marker) {
+			return true
+		}
+	}
+	return rebaseInProgress(repoPath)
+}
+
+func rebaseInProgress(repoPath string) bool {
+	dir := gitDir(repoPath)
+	return IsDir(path.Join(dir, "rebase-merge")) || IsDir(path.Join(dir, "rebase-apply"))
+}
+
+// A RebaseConflictError names the repos left mid-rebase by a conflict.
+type RebaseConflictError struct {
+	Paths []string
+}
+
+func (e *RebaseConflictError) Error() string {
+	var b bytes.Buffer
+	for _, p := range e.Paths {
+		fmt.Fprintf(&b, "Rebase stopped with conflicts in %s\n", p)
+	}
+	b.WriteString("Resolve the conflicts in each repo and run 'git rebase --continue'," +
+		" or 'git rebase --abort' to give up.\nThen rerun the command to update the remaining repos.")
+	return b.String()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsRebaseCommand(t *testing.T) {
+	for args, want := range map[string]bool{
+		"rebase origin/master": true,
+		"pull":                 true,
+		"svn rebase":           true,
+		"svn fetch":            false,
+		"svn":                  false,
+		"log":                  false,
+		"":                     false,
+	} {
+		if got := isRebaseCommand(strings.Fields(args)); got != want {
+			t.Errorf("isRebaseCommand(%q) = %v", args, got)
+		}
+	}
+}
+
+func TestRebaseConflictHalts(t *testing.T) {
+	root := diskTree(t)
+	fakeGit(t, `case "$PWD" in */libs/b) echo 'CONFLICT (content): Merge conflict in b.c'; exit 1;; esac; echo rebased`)
+
+	var failed []*Repo
+	var err error
+	out := captureStdout(t, func() { failed, err = ForeachFailed(root.Repos(), []string{"svn", "rebase"}) })
+	conflict, ok := err.(*RebaseConflictError)
+	if !ok || !sameStrings(conflict.Paths, []string{root.Externals[0].Path}) {
+		t.Fatalf("returned %v", err)
+	}
+	if len(failed) != 1 || strings.Count(out, "rebased") != 1 {
+		t.Errorf("the repos after the conflict were rebased:\n%s", out)
+	}
+
+	// Other commands keep going after the failure.
+	out = captureStdout(t, func() { failed, err = ForeachFailed(root.Repos(), []string{"log"}) })
+	if err != nil || len(failed) != 1 || strings.Count(out, "rebased") != 3 {
+		t.Errorf("log returned %v, failed in %d:\n%s", err, len(failed), out)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Convert a path relative to the repo into a path relative to the root of the
+// repo's tree, so output from all the repos reads like one project.
+func RootRelative(repo *Repo, localPath string) string {
+	root := repo.Root
+	if root == nil {
+		root = repo
+	}
+
+	rel, err := filepath.Rel(root.Path, repo.Path)
+	if err != nil || rel == "." {
+		return localPath
+	}
+	return path.Join(filepath.ToSlash(rel), localPath)
+}
+
+// Return the directory prefix that makes the repo's paths root relative,
+// with a trailing slash, or "" for the root itself.
+func rootRelativePrefix(repo *Repo) string {
+	prefix := RootRelative(repo, "")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
+
+// Run git in each repo and print its output with the path at the start of
+// each line made root relative. The path ends at the first sep in the line,
+// or at the end of the line if sep is empty.
+func foreachRootRelative(repos []*Repo, sep string, args []string) error {
+	for _, r := range repos {
+		out, err := execCmdCapture(r.Path, "git", args...)
+		if err != nil {
+			// Exit status 1 from grep means nothing matched.
+			if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+				os.Stderr.Write(out)
+				return fmt.Errorf("git %s failed in %s: %v", args[0], r.Path, err)
+			}
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(out))
+		for scanner.Scan() {
+			fmt.Println(rootRelativeLine(r, scanner.Text(), sep))
+		}
+	}
+	return nil
+}
+
+func rootRelativeLine(repo *Repo, line, sep string) string {
+	if sep == "" {
+		return RootRelative(repo, line)
+	}
+
+	i := strings.Index(line, sep)
+	if i < 0 {
+		return line
+	}
+	return RootRelative(repo, line[:i]) + line[i:]
+}
+
+// List the files of all the repos, relative to the root.
+func cmdLsFiles(args []string, repo *Repo) error {
+	return foreachRootRelative(repo.Repos(), "", args)
+}
+
+// Search all the repos, printing matching paths relative to the root.
+func cmdGrep(args []string, repo *Repo) error {
+	return foreachRootRelative(repo.Repos(), ":", args)
+}
+
+// Diff all the repos as one patch with root relative paths. --since with an
+// svn revision diffs the commits after that revision instead of the working
+// tree. --format=svn writes the patch in svn's format.
+func cmdDiff(args []string, repo *Repo) error {
+	rev, rest := splitSinceRev(args[1:])
+	svnFormat := false
+	for i, a := range rest {
+		if a == "--format=svn" {
+			svnFormat = true
+			rest = append(rest[:i:i], rest[i+1:]...)
+			break
+		}
+	}
+
+	repos := repo.Repos()
+	if rev != "" {
+		repos = withSvnHistory(repos)
+	}
+	for _, r := range repos {
+		prefix := rootRelativePrefix(r)
+		diffArgs := []string{"diff"}
+		if svnFormat {
+			// Before the user's arguments, which may end in paths.
+			diffArgs = append(diffArgs, "--no-color")
+		}
+		diffArgs = append(diffArgs, "--src-prefix=a/"+prefix, "--dst-prefix=b/"+prefix)
+		var commit string
+		if rev != "" {
+			var err error
+			commit, err = sinceCommit(r.Path, rev)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
+			}
+			if commit == "" {
+				commit = emptyTree
+			}
+			diffArgs = append(diffArgs, beforeDashes(rest, commit, "HEAD")...)
+		} else {
+			diffArgs = append(diffArgs, rest...)
+		}
+
+		var err error
+		if svnFormat {
+			err = svnDiff(r, diffArgs, commit)
+		} else {
+			err = execCmd(r.Path, "git", diffArgs...)
+		}
+		if err != nil {
+			return fmt.Errorf("git diff failed in %s: %v", r.Path, err)
+		}
+	}
+	return nil
+}
+
+// Run git diff with diffArgs, which turn off color, and print it in svn's
+// format. since is the commit a diff of commits up to HEAD starts at, "" for
+// a diff of the working tree.
+func svnDiff(r *Repo, diffArgs []string, since string) error {
+	out, err := execCmdCapture(r.Path, "git", diffArgs...)
+	if err != nil {
+		os.Stderr.Write(out)
+		return err
+	}
+
+	oldLabel, newLabel := svnRevLabel(r.Path, "HEAD"), "(working copy)"
+	if since != "" {
+		oldLabel = svnRevLabel(r.Path, since)
+		newLabel = svnRevLabel(r.Path, "HEAD")
+	}
+	os.Stdout.Write(gitToSvnDiff(out, oldLabel, newLabel))
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestRootRelative(t *testing.T) {
+	root := testTree()
+	inner := &root.Externals[1].Externals[0]
+	for _, c := range []struct {
+		repo      *Repo
+		line, sep string
+		want      string
+	}{
+		{root, "main.c", "", "main.c"},
+		{inner, "src/x.c", "", "libs/a/inner/src/x.c"},
+		{inner, "src/x.c:12:found", ":", "libs/a/inner/src/x.c:12:found"},
+		{inner, "no separator", ":", "no separator"},
+	} {
+		if got := rootRelativeLine(c.repo, c.line, c.sep); got != c.want {
+			t.Errorf("%s in %s gave %q, want %q", c.line, c.repo.Path, got, c.want)
+		}
+	}
+
+	if p := rootRelativePrefix(root); p != "" {
+		t.Errorf("root prefix is %q", p)
+	}
+	if p := rootRelativePrefix(inner); p != "libs/a/inner/" {
+		t.Errorf("inner prefix is %q", p)
+	}
+}
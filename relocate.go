@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Move the tree on disk to newRoot and rewrite the paths in the config.
+func (repo *Repo) Relocate(newRoot string) error {
+	newRoot, err := filepath.Abs(newRoot)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(newRoot); err == nil {
+		return fmt.Errorf("%s already exists", newRoot)
+	}
+
+	oldRoot := repo.Path
+	err = os.Rename(oldRoot, newRoot)
+	if err != nil {
+		return err
+	}
+	RewritePaths(repo, oldRoot, newRoot)
+	repo.repairWorktrees()
+	fmt.Printf("Moved %s to %s\n", oldRoot, newRoot)
+	return repo.WriteConfig()
+}
+
+// Return the path of p relative to dir, "" if it isn't inside dir.
+func relPath(dir, p string) string {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Guess the path relative to dir of an external whose stored path p is
+// stale: the longest trailing part of p that is a repo under dir.
+func guessRelPath(dir, p string) string {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	for i := range parts {
+		rel := strings.Join(parts[i:], "/")
+		if IsRepo(path.Join(dir, rel)) {
+			return rel
+		}
+	}
+	return ""
+}
+
+// Set the path of each external from the path of the repo defining it and
+// its RelPath, returning the repos whose path changed. Externals from configs
+// without RelPath get it from their stored path if that is inside the repo,
+// or else from the end of it that names a repo inside the repo.
+func (repo *Repo) Relink() []*Repo {
+	moved := make(map[string]string)
+	var changed []*Repo
+	var relink func(r *Repo)
+	relink = func(r *Repo) {
+		for i := range r.Externals {
+			ext := &r.Externals[i]
+			if ext.RelPath == "" {
+				ext.RelPath = relPath(r.Path, ext.Path)
+			}
+			if ext.RelPath == "" {
+				ext.RelPath = guessRelPath(r.Path, ext.Path)
+			}
+			if ext.RelPath != "" {
+				if p := path.Join(r.Path, ext.RelPath); p != ext.Path {
+					moved[ext.Path] = p
+					ext.Path = p
+					changed = append(changed, ext)
+				}
+			}
+			relink(ext)
+		}
+	}
+	relink(repo)
+
+	for _, r := range repo.Repos() {
+		if p, ok := moved[r.WorktreeOf]; ok {
+			r.WorktreeOf = p
+		}
+	}
+	return changed
+}
+
+func cmdRelink(args []string, repo *Repo) error {
+	flags := flag.NewFlagSet("relink", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish relink\n")
+		fmt.Fprint(os.Stderr, "\nRepair the paths in the config of a tree moved without 'gish relocate', from the\n")
+		fmt.Fprint(os.Stderr, "path of each external relative to the repo defining it.\n")
+	}
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return &UsageError{flags.Usage, "Too many arguments."}
+	}
+
+	changed := repo.Relink()
+	for _, r := range changed {
+		fmt.Printf("Relinked %s\n", r.Path)
+	}
+	if len(changed) > 0 {
+		repo.repairWorktrees()
+	}
+	return repo.WriteConfig()
+}
+
+func cmdRelocate(args []string, _ *Repo) error {
+	flags := flag.NewFlagSet("relocate", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish relocate <newPath>\n")
+		fmt.Fprint(os.Stderr, "\nMove the tree to a new directory and update the paths in its config.\n")
+	}
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return &UsageError{flags.Usage, "relocate needs the new path of the tree."}
+	}
+
+	// Loaded here rather than by dispatch, as the lock moves with the tree.
+	repo, err := NewRepo(args)
+	if err != nil {
+		return err
+	}
+	lock, err := repo.Lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if err := repo.runPreHook(args[0]); err != nil {
+		return err
+	}
+	err = repo.Relocate(flags.Arg(0))
+	if err == nil {
+		lock.Moved(repo.Path)
+	}
+	// In the new root if the tree moved.
+	repo.runPostHook(args[0], err)
+	return err
+}
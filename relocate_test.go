@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRelink(t *testing.T) {
+	useMemFS(t)
+	makeRepo(t, "/new/root/libs/b")
+
+	// The tree was moved from /old/root, and only some externals recorded
+	// their path relative to the repo defining them.
+	root := &Repo{Path: "/new/root", Url: "u"}
+	root.Externals = []Repo{
+		{Path: "/old/root/libs/a", RelPath: "libs/a", Url: "a",
+			Externals: []Repo{{Path: "/old/root/libs/a/inner", RelPath: "inner", Url: "inner"}}},
+		{Path: "/old/root/libs/b", Url: "b"},
+		{Path: "/old/root/libs/c", Url: "c", WorktreeOf: "/old/root/libs/a", RelPath: "libs/c"},
+		{Path: "/new/root/libs/d", Url: "d"},
+	}
+	root.LinkRoot()
+
+	changed := root.Relink()
+	if len(changed) != 4 {
+		t.Errorf("%d repos changed, want 4", len(changed))
+	}
+	want := map[string]string{
+		"a":     "/new/root/libs/a",
+		"inner": "/new/root/libs/a/inner",
+		"b":     "/new/root/libs/b",
+		"c":     "/new/root/libs/c",
+		"d":     "/new/root/libs/d",
+	}
+	for _, r := range root.Repos()[1:] {
+		if r.Path != want[r.Url] {
+			t.Errorf("external %s is at %s, want %s", r.Url, r.Path, want[r.Url])
+		}
+	}
+
+	if c := root.Externals[2]; c.WorktreeOf != "/new/root/libs/a" {
+		t.Errorf("worktree of %s, want /new/root/libs/a", c.WorktreeOf)
+	}
+	if b := root.Externals[1]; b.RelPath != "libs/b" {
+		t.Errorf("guessed RelPath %q for libs/b", b.RelPath)
+	}
+	if d := root.Externals[3]; d.RelPath != "libs/d" {
+		t.Errorf("RelPath %q for an external that didn't move", d.RelPath)
+	}
+}
+
+func TestRelocate(t *testing.T) {
+	root := diskTree(t)
+	oldRoot := root.Path
+	newRoot := filepath.Join(t.TempDir(), "moved")
+	captureStdout(t, func() {
+		if err := root.Relocate(newRoot); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if _, err := os.Stat(oldRoot); !os.IsNotExist(err) {
+		t.Errorf("%s is still there: %v", oldRoot, err)
+	}
+	loaded, err := LoadConfig(newRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range loaded.Repos() {
+		if r.Path != newRoot && !strings.HasPrefix(r.Path, newRoot+"/") {
+			t.Errorf("stored path %s isn't under %s", r.Path, newRoot)
+		}
+		if !IsRepo(r.Path) {
+			t.Errorf("%s isn't a repo", r.Path)
+		}
+	}
+
+	if err := root.Relocate(filepath.Dir(newRoot)); err == nil {
+		t.Error("relocated onto an existing directory")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// A PathRemap moves externals away from the paths their svn:externals give.
+// It is stored with the root repo so the externals get the same paths each
+// time they are loaded.
+type PathRemap struct {
+	Prefix string            `json:",omitempty"` // Directory the root's externals are moved under
+	Map    map[string]string `json:",omitempty"` // Root relative path to the path to use instead
+	Strip  string            `json:",omitempty"` // Leading directory removed from externals' paths
+}
+
+// Return the remapped path of an external of repo.
+// Map entries apply to externals anywhere in the tree, but can't move an
+// external out of the repo it belongs to, as the repo ignores it. The prefix
+// only applies to the root's externals, as their own externals are already
+// inside them. The stripped directory is relative to the repo defining the
+// external, so stripping never moves an external out of its repo.
+func (repo *Repo) remapPath(extPath string) (string, error) {
+	root := repo.Root
+	if root == nil {
+		root = repo
+	}
+	m := root.PathRemap
+	if m == nil {
+		return extPath, nil
+	}
+
+	rel, err := filepath.Rel(root.Path, extPath)
+	if err != nil {
+		return extPath, nil
+	}
+	rel = filepath.ToSlash(rel)
+	if to, ok := m.Map[rel]; ok {
+		mapped := path.Join(root.Path, to)
+		if !strings.HasPrefix(mapped, path.Clean(repo.Path)+"/") {
+			return "", fmt.Errorf("The path map moves external %s out of its repo %s", rel, repo.Path)
+		}
+		return mapped, nil
+	}
+	if m.Strip != "" {
+		own, err := filepath.Rel(repo.Path, extPath)
+		if err == nil {
+			own = filepath.ToSlash(own)
+			if own == m.Strip {
+				return "", fmt.Errorf("Stripping %s would leave no path for external %s", m.Strip, rel)
+			}
+			if strings.HasPrefix(own, m.Strip+"/") {
+				extPath = path.Join(repo.Path, strings.TrimPrefix(own, m.Strip+"/"))
+				if repo == root {
+					rel = strings.TrimPrefix(own, m.Strip+"/")
+				}
+			}
+		}
+	}
+	if m.Prefix != "" && repo == root {
+		return path.Join(root.Path, m.Prefix, rel), nil
+	}
+	return extPath, nil
+}
+
+// Check that a remapped path stays inside the root repo.
+func checkRemapPath(p string) error {
+	clean := path.Clean(p)
+	if path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("%q must be a path inside the repo", p)
+	}
+	return nil
+}
+
+// Read a path mapping file. Each line is an external's path, relative to the
+// root, and the path to use instead, separated by whitespace. Blank lines and
+// lines starting with # are ignored.
+func loadPathMap(file string) (map[string]string, error) {
+	b, err := fsys.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]string)
+	for n, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected '<path> <new path>'", file, n+1)
+		}
+		for _, p := range fields {
+			if err := checkRemapPath(p); err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", file, n+1, err)
+			}
+		}
+		m[path.Clean(fields[0])] = path.Clean(fields[1])
+	}
+	return m, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Return the paths of the repo's externals.
+func externalPaths(repo *Repo) []string {
+	var paths []string
+	for _, ext := range repo.Externals {
+		paths = append(paths, ext.Path)
+	}
+	return paths
+}
+
+func TestRemapPrefix(t *testing.T) {
+	root := cookRoot(t)
+	root.PathRemap = &PathRemap{Prefix: "vendor"}
+	if err := root.CookExternals("# /\n/^/libs/a deep/lib/a\n# /src/\n/src/^/libs/b b\n"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/tree/root/vendor/deep/lib/a", "/tree/root/vendor/src/b"}
+	if got := externalPaths(root); !sameStrings(got, want) {
+		t.Errorf("prefixed to %q, want %q", got, want)
+	}
+
+	// The prefix applies only to the root's externals.
+	a := &root.Externals[0]
+	if err := a.CookExternals("# /\n/^/libs/c c\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.Externals[0].Path; got != "/tree/root/vendor/deep/lib/a/c" {
+		t.Errorf("an external of an external moved to %s", got)
+	}
+}
+
+func TestRemapFile(t *testing.T) {
+	root := cookRoot(t)
+	mapFile := "/tree/paths.map"
+	if err := fsys.MkdirAll("/tree", 0770); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile(mapFile, []byte("# renames\ndeep/lib/a  a\n\nsrc/b lib/b/\n"), 0660); err != nil {
+		t.Fatal(err)
+	}
+	m, err := loadPathMap(mapFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.PathRemap = &PathRemap{Map: m}
+	if err := root.CookExternals("# /\n/^/libs/a deep/lib/a\n/^/libs/c c\n# /src/\n/src/^/libs/b b\n"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/tree/root/a", "/tree/root/c", "/tree/root/lib/b"}
+	if got := externalPaths(root); !sameStrings(got, want) {
+		t.Errorf("mapped to %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{"a", "a b c", "/abs b", "a ../b", "a ."} {
+		if err := fsys.WriteFile(mapFile, []byte(bad+"\n"), 0660); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadPathMap(mapFile); err == nil {
+			t.Errorf("map %q was loaded", bad)
+		}
+	}
+
+	// Two externals mapped to one path collide.
+	root = cookRoot(t)
+	root.PathRemap = &PathRemap{Map: map[string]string{"x": "lib", "y": "lib"}}
+	if err := root.CookExternals("# /\n/^/libs/a x\n/^/libs/b y\n"); err == nil || !strings.Contains(err.Error(), "both resolve") {
+		t.Errorf("colliding map gave %v", err)
+	}
+}
+
+func TestRemapStrip(t *testing.T) {
+	root := cookRoot(t)
+	root.PathRemap = &PathRemap{Strip: "third_party", Prefix: "vendor"}
+	if err := root.CookExternals("# /\n/^/libs/a third_party/a\n/^/libs/c c\n"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/tree/root/vendor/a", "/tree/root/vendor/c"}
+	if got := externalPaths(root); !sameStrings(got, want) {
+		t.Errorf("stripped to %q, want %q", got, want)
+	}
+
+	// The directory is stripped relative to the repo defining the external.
+	a := &root.Externals[0]
+	if err := a.CookExternals("# /\n/^/libs/d third_party/d\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.Externals[0].Path; got != "/tree/root/vendor/a/d" {
+		t.Errorf("an external of an external stripped to %s", got)
+	}
+
+	root = cookRoot(t)
+	root.PathRemap = &PathRemap{Strip: "third_party"}
+	if err := root.CookExternals("# /\n/^/libs/a third_party\n"); err == nil {
+		t.Error("stripping an external's whole path wasn't an error")
+	}
+	if err := root.CookExternals("# /\n/^/libs/a third_party/a\n/^/libs/b a\n"); err == nil || !strings.Contains(err.Error(), "both resolve") {
+		t.Errorf("externals stripped onto each other gave %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Replace the prefix old of each repo's svn url with new, in the config and
+// in the repo's git-svn or git remote. Every rewritten url is checked before
+// any repo is changed. Returns the number of repos changed.
+func (repo *Repo) ReplaceUrlPrefix(old, new string) (int, error) {
+	repos := repo.Repos()
+	newUrls := make([]string, len(repos))
+	for i, r := range repos {
+		if !hasUrlPrefix(r.Url, old) {
+			continue
+		}
+
+		newUrl := new + strings.TrimPrefix(r.Url, old)
+		u, err := url.Parse(newUrl)
+		if err != nil {
+			return 0, fmt.Errorf("Rewritten url for %s is invalid: %v", r.Path, err)
+		}
+		if u.Scheme == "" || u.Host == "" && u.Scheme != "file" {
+			return 0, fmt.Errorf("Rewritten url %q for %s has no scheme or server", newUrl, r.Path)
+		}
+		newUrls[i] = newUrl
+	}
+
+	changed := 0
+	for i, r := range repos {
+		if newUrls[i] == "" {
+			continue
+		}
+
+		switch {
+		case !IsRepo(r.Path):
+		case isGitSvn(r.Path):
+			if err := relocateGitSvn(r.Path, old, new); err != nil {
+				return changed, err
+			}
+		case hasRemote(r.Path, "origin"):
+			err := execCmd(r.Path, "git", "remote", "set-url", "origin", newUrls[i])
+			if err != nil {
+				return changed, fmt.Errorf("Updating origin of %s failed: %v", r.Path, err)
+			}
+		}
+
+		fmt.Printf("%s: %s -> %s\n", r.Path, r.Url, newUrls[i])
+		r.Url = newUrls[i]
+		changed++
+	}
+	return changed, nil
+}
+
+// Report whether u starts with prefix at a path boundary, so a prefix of
+// http://svn doesn't match http://svn2/repo.
+func hasUrlPrefix(u, prefix string) bool {
+	if !strings.HasPrefix(u, prefix) {
+		return false
+	}
+	return len(u) == len(prefix) || strings.HasSuffix(prefix, "/") || u[len(prefix)] == '/'
+}
+
+// Point git-svn's remote in the repo at the moved server. rewriteRoot keeps
+// the old url, the one in the git-svn-id of the commits already fetched, so
+// git-svn still finds its history.
+func relocateGitSvn(repoPath, old, new string) error {
+	out, err := execCmdCapture(repoPath, "git", "config", "--get", "svn-remote.svn.url")
+	if err != nil {
+		return fmt.Errorf("No svn-remote.svn.url in %s: %v", repoPath, err)
+	}
+	svnUrl := strings.TrimSpace(string(out))
+	if !hasUrlPrefix(svnUrl, old) {
+		return nil
+	}
+	newSvnUrl := new + strings.TrimPrefix(svnUrl, old)
+
+	rewriteRoot := svnUrl
+	if out, err := execCmdCapture(repoPath, "git", "config", "--get", "svn-remote.svn.rewriteRoot"); err == nil {
+		rewriteRoot = strings.TrimSpace(string(out))
+	}
+	if rewriteRoot == newSvnUrl {
+		// Moved back to where the history was fetched from.
+		_, err = execCmdCapture(repoPath, "git", "config", "--unset", "svn-remote.svn.rewriteRoot")
+	} else {
+		_, err = execCmdCapture(repoPath, "git", "config", "svn-remote.svn.rewriteRoot", rewriteRoot)
+	}
+	if err == nil {
+		_, err = execCmdCapture(repoPath, "git", "config", "svn-remote.svn.url", newSvnUrl)
+	}
+	if err != nil {
+		return fmt.Errorf("Updating the svn remote of %s failed: %v", repoPath, err)
+	}
+	return nil
+}
+
+func hasRemote(repoPath, name string) bool {
+	_, err := execCmdCombinedOutput(repoPath, "git", "remote", "get-url", name)
+	return err == nil
+}
+
+func cmdRemoteUrl(args []string, repo *Repo) error {
+	var replace string
+	flags := flag.NewFlagSet("remote-url", flag.ContinueOnError)
+	flags.StringVar(&replace, "replace", "", "Rewrite urls starting with old to start with new, given as old=new.")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish remote-url [options]\n")
+		fmt.Fprint(os.Stderr, "\tPrint the svn url of each repo, or rewrite them after a server move.\n")
+		fmt.Fprint(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+
+	if replace == "" {
+		for _, r := range repo.Repos() {
+			fmt.Printf("%s\t%s\n", r.Path, r.Url)
+		}
+		return nil
+	}
+
+	parts := strings.SplitN(replace, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return &UsageError{flags.Usage, "-replace must be given as old=new."}
+	}
+
+	changed, err := repo.ReplaceUrlPrefix(parts[0], parts[1])
+	if err != nil {
+		return err
+	}
+	if changed == 0 {
+		fmt.Printf("No urls start with %s\n", parts[0])
+	}
+	return nil
+}
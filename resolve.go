@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func cmdResolve(args []string, _ *Repo) error {
+	var rootUrl, dirUrl string
+	flags := flag.NewFlagSet("resolve", flag.ContinueOnError)
+	flags.StringVar(&rootUrl, "root", "", "Root url of the svn repository, for ^/ and / externals.")
+	flags.StringVar(&dirUrl, "dir", "", "Url of the directory with the svn:externals property, for ../ and // externals.")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish resolve [options] <externalRef>\n")
+		fmt.Fprint(os.Stderr, "\tPrint the url an svn external reference resolves to.\n")
+		fmt.Fprint(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+
+	if len(args) < 2 {
+		return &UsageError{flags.Usage, "Not enough arguments to 'gish resolve'."}
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return &UsageError{flags.Usage, "A single external reference is required."}
+	}
+
+	resolved, err := ReplaceRelative(rootUrl, dirUrl, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(resolved)
+	return nil
+}
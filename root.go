@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Return the svn url of the root repo at rootPath, from its config if it has
+// one, otherwise from git-svn.
+func rootUrl(rootPath string) (string, error) {
+	if repo, err := LoadConfig(rootPath); err == nil && repo.Url != "" {
+		return repo.Url, nil
+	}
+	return GitSvnInfo(rootPath, "URL")
+}
+
+func cmdRoot(args []string, _ *Repo) error {
+	var withUrl bool
+	flags := flag.NewFlagSet("root", flag.ContinueOnError)
+	flags.BoolVar(&withUrl, "url", false, "Also print the svn url of the root repo.")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish root [options]\n")
+		fmt.Fprint(os.Stderr, "\tPrint the path of the root repo of the tree containing the current directory.\n")
+		fmt.Fprint(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+
+	rootPath, err := FindRootRepoPath()
+	if err != nil {
+		return err
+	}
+	fmt.Println(rootPath)
+
+	if withUrl {
+		u, err := rootUrl(rootPath)
+		if err != nil {
+			return err
+		}
+		fmt.Println(u)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCmdRoot(t *testing.T) {
+	root := diskTree(t)
+	if err := root.WriteConfig(); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(root.Externals[1].Externals[0].Path)
+
+	out := captureStdout(t, func() {
+		if err := cmdRoot([]string{"root", "-url"}, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if want := root.Path + "\n" + root.Url + "\n"; out != want {
+		t.Errorf("printed %q, want %q", out, want)
+	}
+}
+
+func TestFindRootRepoPathNotInRepo(t *testing.T) {
+	useMemFS(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	got, err := FindRootRepoPath()
+	notInRepo, ok := err.(*NotInRepoError)
+	if !ok || notInRepo.Dir != dir || got != dir {
+		t.Fatalf("returned %q, %v", got, err)
+	}
+	if !strings.Contains(err.Error(), "gish clone") {
+		t.Errorf("the error doesn't say how to get a tree: %v", err)
+	}
+
+	makeRepo(t, dir)
+	if got, err := FindRootRepoPath(); err != nil || got != dir {
+		t.Errorf("inside a repo returned %q, %v", got, err)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+)
+
+// A step of the self check.
+type selfcheckStep struct {
+	Name string
+	Run  func() error
+}
+
+// Return the steps that build a local svn repo whose main directory has lib
+// as an external, clone main with the gish binary at exe and check the tree.
+func selfcheckSteps(exe, dir string) []selfcheckStep {
+	svnRepo := path.Join(dir, "svn")
+	url := "file://" + svnRepo
+	src := path.Join(dir, "src")
+	wc := path.Join(dir, "wc")
+	tree := path.Join(dir, "tree")
+
+	run := func(dir, name string, args ...string) error {
+		out, err := execCmdCapture(dir, name, args...)
+		if err != nil {
+			return fmt.Errorf("%s failed: %v\n%s", name, err, out)
+		}
+		return nil
+	}
+
+	return []selfcheckStep{
+		{"create svn repo", func() error {
+			return run("", "svnadmin", "create", svnRepo)
+		}},
+		{"import main and lib", func() error {
+			for _, d := range []string{"main", "lib"} {
+				if err := fsys.MkdirAll(path.Join(src, d), 0770); err != nil {
+					return err
+				}
+				if err := fsys.WriteFile(path.Join(src, d, d+".txt"), []byte(d+"\n"), 0660); err != nil {
+					return err
+				}
+				if err := run("", "svn", "import", "-q", "-m", d, path.Join(src, d), url+"/"+d); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"add the external", func() error {
+			if err := run("", "svn", "checkout", "-q", url+"/main", wc); err != nil {
+				return err
+			}
+			if err := run(wc, "svn", "propset", "-q", "svn:externals", "^/lib lib", "."); err != nil {
+				return err
+			}
+			return run(wc, "svn", "commit", "-q", "-m", "external")
+		}},
+		{"gish clone", func() error {
+			return run(dir, exe, "clone", url+"/main", tree)
+		}},
+		{"check the tree", func() error {
+			for _, f := range []string{"main.txt", "lib/lib.txt"} {
+				if _, err := fsys.Stat(path.Join(tree, f)); err != nil {
+					return fmt.Errorf("%s wasn't cloned: %v", f, err)
+				}
+			}
+			repo, err := LoadConfig(tree)
+			if err != nil {
+				return err
+			}
+			if len(repo.Externals) != 1 || repo.Externals[0].Path != path.Join(tree, "lib") {
+				return fmt.Errorf("the config doesn't have lib as the only external")
+			}
+			return nil
+		}},
+	}
+}
+
+// Report the tools the self check needs that aren't installed.
+func selfcheckMissingTools() []string {
+	var missing []string
+	for _, tool := range []string{"svnadmin", "svn", "git"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			missing = append(missing, tool)
+		}
+	}
+	if len(missing) == 0 {
+		if _, err := execCmdCapture("", "git", "svn", "--version"); err != nil {
+			missing = append(missing, "git svn")
+		}
+	}
+	return missing
+}
+
+// Clone a tiny local svn repo with an external, to check that gish works
+// with the svn and git installed here.
+func cmdSelfcheck(args []string, _ *Repo) error {
+	var keep bool
+	flags := flag.NewFlagSet("selfcheck", flag.ContinueOnError)
+	flags.BoolVar(&keep, "keep", false, "Leave the svn repo and the clone in place afterwards.")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish selfcheck [options] [dir]\n")
+		fmt.Fprint(os.Stderr, "\tBuild a local svn repo with an external in a new directory under dir, or in\n")
+		fmt.Fprint(os.Stderr, "\ta temporary directory, clone it with gish and check the tree. Needs svnadmin,\n")
+		fmt.Fprint(os.Stderr, "\tsvn and git svn.\n")
+		fmt.Fprint(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		return &UsageError{flags.Usage, "Too many arguments."}
+	}
+
+	if missing := selfcheckMissingTools(); len(missing) > 0 {
+		return fmt.Errorf("Can't run the self check, not installed: %v", missing)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	dir := flags.Arg(0)
+	if dir == "" {
+		dir, err = ioutil.TempDir("", "gish-selfcheck")
+	} else {
+		// Work in a directory of our own under dir, so that only what the
+		// self check made is removed.
+		dir, err = filepath.Abs(dir)
+		if err == nil {
+			err = fsys.MkdirAll(dir, 0770)
+		}
+		if err == nil {
+			dir, err = ioutil.TempDir(dir, "gish-selfcheck")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if !keep {
+		defer fsys.RemoveAll(dir)
+	}
+
+	for _, step := range selfcheckSteps(exe, dir) {
+		fmt.Printf("selfcheck: %s\n", step.Name)
+		if err := step.Run(); err != nil {
+			fmt.Println("selfcheck: FAIL")
+			return fmt.Errorf("Self check failed to %s: %v", step.Name, err)
+		}
+	}
+	fmt.Println("selfcheck: PASS")
+	if keep {
+		fmt.Printf("The svn repo and clone are in %s\n", dir)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// The self check runs the test binary as gish.
+	if os.Getenv("GISH_TEST_AS_GISH") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestSelfcheck(t *testing.T) {
+	if missing := selfcheckMissingTools(); len(missing) > 0 {
+		t.Skipf("not installed: %v", missing)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GISH_TEST_AS_GISH", "1")
+
+	dir := t.TempDir()
+	for _, step := range selfcheckSteps(exe, dir) {
+		if err := step.Run(); err != nil {
+			t.Fatalf("%s: %v", step.Name, err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// A Server groups the repos of a tree that are hosted on the same svn server.
+type Server struct {
+	Root  string // scheme://host[:port] of the server
+	Repos []*Repo
+}
+
+// Return the server root of an svn url, or the url itself if it can't be parsed.
+func serverRoot(svnUrl string) string {
+	u, err := url.Parse(svnUrl)
+	if err != nil || u.Host == "" {
+		return svnUrl
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// Group repos by svn server, in order of each server's first appearance.
+func Servers(repos []*Repo) []Server {
+	var servers []Server
+	index := make(map[string]int)
+	for _, r := range repos {
+		root := serverRoot(r.Url)
+		i, ok := index[root]
+		if !ok {
+			i = len(servers)
+			index[root] = i
+			servers = append(servers, Server{Root: root})
+		}
+		servers[i].Repos = append(servers[i].Repos, r)
+	}
+	return servers
+}
+
+// Contact each distinct svn server once so the user can authenticate with it.
+// git-svn shares svn's credential cache, so all repos on the server benefit.
+func (repo *Repo) Reauth() error {
+	var failed int
+	for _, server := range Servers(repo.Repos()) {
+		fmt.Printf("Authenticating with %s\n", server.Root)
+		err := execCmd(repo.Path, "svn", "info", server.Repos[0].Url)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "svn info for %s failed: %v\n", server.Root, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d server(s) failed to authenticate", failed)
+	}
+	return nil
+}
+
+func cmdEachServer(args []string, repo *Repo) error {
+	flags := flag.NewFlagSet("each-server", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish each-server <git command> [args]\n")
+		fmt.Fprint(os.Stderr, "\nRun a git command once for each svn server, in the first repo from that server.\n")
+	}
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	gitArgs := flags.Args()
+	if len(gitArgs) == 0 {
+		return &UsageError{flags.Usage, "No git command provided."}
+	}
+
+	var failed int
+	for _, server := range Servers(repo.Repos()) {
+		r := server.Repos[0]
+		if !noHeaders {
+			fmt.Printf("Server %s (%d repos), in %s:\n", server.Root, len(server.Repos), r.Label())
+		}
+		err := execCmd(r.Path, "git", gitArgs...)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Git returned error:", err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("git failed for %d server(s)", failed)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServers(t *testing.T) {
+	servers := Servers(testTree().Repos())
+	if len(servers) != 2 {
+		t.Fatalf("%d servers, want 2", len(servers))
+	}
+	for i, want := range []struct {
+		root  string
+		repos int
+	}{
+		{"https://svn.example.com", 2},
+		{"svn://other.example.com", 2},
+	} {
+		if servers[i].Root != want.root || len(servers[i].Repos) != want.repos {
+			t.Errorf("server %d is %s with %d repos, want %s with %d",
+				i, servers[i].Root, len(servers[i].Repos), want.root, want.repos)
+		}
+	}
+
+	for u, want := range map[string]string{
+		"https://svn.example.com:8443/repo/trunk": "https://svn.example.com:8443",
+		"file:///srv/svn/repo":                    "file:///srv/svn/repo",
+	} {
+		if got := serverRoot(u); got != want {
+			t.Errorf("serverRoot(%s) = %s, want %s", u, got, want)
+		}
+	}
+}
+
+func TestEachServer(t *testing.T) {
+	root := diskTree(t)
+	fakeGit(t, `echo "ran in $PWD"`)
+	var err error
+	out := captureStdout(t, func() { err = cmdEachServer([]string{"each-server", "svn", "info"}, root) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Server https://svn.example.com (2 repos)",
+		"ran in " + root.Path + "\n",
+		"Server svn://other.example.com (2 repos)",
+		"ran in " + root.Externals[1].Path + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("no %q in\n%s", want, out)
+		}
+	}
+	if n := strings.Count(out, "ran in"); n != 2 {
+		t.Errorf("ran %d times:\n%s", n, out)
+	}
+
+	if _, ok := cmdEachServer([]string{"each-server"}, root).(*UsageError); !ok {
+		t.Error("each-server without a command isn't a usage error")
+	}
+}
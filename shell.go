@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const shellPrompt = "gish> "
+
+// Split a shell line into arguments at unquoted blanks, as sh does. Single
+// quotes keep everything up to the next one, in double quotes a backslash
+// only escapes " and \, and outside quotes it keeps the next character.
+func splitShellLine(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, c := range strings.TrimRight(line, "\r\n") {
+		switch {
+		case escaped:
+			if quote == '"' && c != '"' && c != '\\' {
+				arg.WriteRune('\\')
+			}
+			arg.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inArg = c, true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("Unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// Read commands from stdin and run them against the tree, which is loaded
+// once rather than for every command. 'reload' loads it again.
+func cmdShell(args []string, repo *Repo) error {
+	flags := flag.NewFlagSet("shell", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish shell\n")
+		fmt.Fprint(os.Stderr, "\nRun gish commands against the tree without loading it for each one.\n")
+		fmt.Fprint(os.Stderr, "Enter commands without 'gish', e.g. 'status -s'. 'reload' reloads the tree,\n")
+		fmt.Fprint(os.Stderr, "'exit' or end of input ends the shell.\n")
+	}
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return &UsageError{flags.Usage, "shell takes no arguments."}
+	}
+
+	for {
+		fmt.Print(shellPrompt)
+		line, err := stdinReader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			fmt.Println()
+			return nil
+		} else if err != nil && err != io.EOF {
+			return err
+		}
+
+		cmdLineArgs, err := splitShellLine(line)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		if len(cmdLineArgs) == 0 {
+			continue
+		}
+
+		switch cmdLineArgs[0] {
+		case "exit", "quit":
+			return nil
+		case "shell":
+			fmt.Fprintln(os.Stderr, "Already in the gish shell.")
+			continue
+		case "reload":
+			reloaded, rerr := NewRepo(args)
+			if rerr != nil {
+				fmt.Fprintln(os.Stderr, "Reload failed, keeping the loaded tree:", rerr)
+				continue
+			}
+			repo = reloaded
+			continue
+		}
+
+		// Each command sees the working trees as they are now.
+		resetStatusCache()
+		failedClones = nil
+		heldPinned = nil
+		onError = onErrorContinue
+		chdirRelative = ""
+		cloneFilters = nil
+
+		err = dispatch(cmdLineArgs, repo)
+		if usageErr, ok := err.(*UsageError); ok {
+			fmt.Fprintln(os.Stderr, usageErr.Msg)
+			usageErr.Usage()
+		} else if err != nil && err != flag.ErrHelp && err != errReported {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+}
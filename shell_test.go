@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitShellLine(t *testing.T) {
+	for _, c := range []struct {
+		line string
+		want []string
+	}{
+		{"status -s\n", []string{"status", "-s"}},
+		{"  commit -m \"two words\"  \r\n", []string{"commit", "-m", "two words"}},
+		{`grep 'a "b" \c'`, []string{"grep", `a "b" \c`}},
+		{`log --grep="say \"hi\" \n"`, []string{"log", `--grep=say "hi" \n`}},
+		{`ls-files my\ dir`, []string{"ls-files", "my dir"}},
+		{`commit -m ''`, []string{"commit", "-m", ""}},
+		{"\n", nil},
+	} {
+		got, err := splitShellLine(c.line)
+		if err != nil {
+			t.Errorf("%q: %v", c.line, err)
+		} else if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q split into %q, want %q", c.line, got, c.want)
+		}
+	}
+
+	for _, line := range []string{`commit -m "open`, `grep 'open`} {
+		if _, err := splitShellLine(line); err == nil {
+			t.Errorf("%q: no error for an unterminated quote", line)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// The object name of git's empty tree, to diff a repo's whole history.
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+var svnRevRegex = regexp.MustCompile(`^r?(\d+)$`)
+
+// Remove a --since option giving an svn revision from args, returning the
+// revision number. --since with a date is left for git.
+func splitSinceRev(args []string) (rev string, rest []string) {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		value, next := "", i
+		if strings.HasPrefix(a, "--since=") {
+			value = strings.TrimPrefix(a, "--since=")
+		} else if a == "--since" && i+1 < len(args) {
+			value, next = args[i+1], i+1
+		}
+		if m := svnRevRegex.FindStringSubmatch(value); m != nil && rev == "" {
+			rev = m[1]
+			i = next
+			continue
+		}
+		rest = append(rest, a)
+	}
+	return rev, rest
+}
+
+// Return the commit of svn revision rev in the repo, or the last commit
+// before it if the revision didn't change the repo. "" means the revision
+// predates the repo's history.
+func sinceCommit(repoPath, rev string) (string, error) {
+	return commitAtRev(repoPath, rev, "")
+}
+
+// Return args with revs added before any "--", so they aren't taken as
+// paths.
+func beforeDashes(args []string, revs ...string) []string {
+	out := make([]string, 0, len(args)+len(revs))
+	for i, a := range args {
+		if a == "--" {
+			out = append(out, revs...)
+			return append(out, args[i:]...)
+		}
+		out = append(out, a)
+	}
+	return append(out, revs...)
+}
+
+// Select the git-svn repos on disk, whose history can be searched for svn
+// revisions. The others are noted on stderr, as stdout may be a patch.
+func withSvnHistory(repos []*Repo) []*Repo {
+	var selected []*Repo
+	for _, r := range repos {
+		switch {
+		case !IsRepo(r.Path):
+			fmt.Fprintf(os.Stderr, "Repo %s: %s, skipping.\n", r.Label(), stateMissing)
+		case !isGitSvn(r.Path):
+			fmt.Fprintf(os.Stderr, "Repo %s: not a git-svn repo, skipping.\n", r.Label())
+		default:
+			selected = append(selected, r)
+		}
+	}
+	return selected
+}
+
+// Like sinceCommit, but searching the history of ref rather than the current
+// branch, unless ref is "".
+func commitAtRev(repoPath, rev, ref string) (string, error) {
+	args := []string{"svn", "find-rev", "--before", "r" + rev}
+	if ref != "" {
+		args = append(args, ref)
+	}
+	out, err := execCmdCapture(repoPath, "git", args...)
+	if err != nil {
+		return "", fmt.Errorf("git svn find-rev r%s failed in %s: %v", rev, repoPath, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Run git log in each repo. --since with an svn revision limits each repo's
+// log to the commits after that revision, skipping repos without svn history.
+func cmdGitLog(args []string, repo *Repo) error {
+	rev, rest := splitSinceRev(args[1:])
+	if rev == "" {
+		return Foreach(repo.Repos(), args)
+	}
+
+	for _, r := range withSvnHistory(repo.Repos()) {
+		commit, err := sinceCommit(r.Path, rev)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		logArgs := append([]string{"log"}, rest...)
+		if commit != "" {
+			logArgs = beforeDashes(logArgs, commit+"..HEAD")
+		}
+		printHeader(r)
+		err = execCmd(r.Path, "git", logArgs...)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Git returned error:", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitSinceRev(t *testing.T) {
+	for _, c := range []struct{ args, rev, rest string }{
+		{"--since r100 --oneline", "100", "--oneline"},
+		{"--since=100 -- src", "100", "-- src"},
+		{"--since=2.weeks --stat", "", "--since=2.weeks --stat"},
+		{"--since yesterday", "", "--since yesterday"},
+		{"--oneline --since", "", "--oneline --since"},
+		{"--since r5 --since r6", "5", "--since r6"},
+	} {
+		rev, rest := splitSinceRev(strings.Fields(c.args))
+		if rev != c.rev || strings.Join(rest, " ") != c.rest {
+			t.Errorf("%q split into %q and %q", c.args, rev, rest)
+		}
+	}
+}
+
+func TestBeforeDashes(t *testing.T) {
+	for _, c := range []struct{ args, want string }{
+		{"log --oneline", "log --oneline abc..HEAD"},
+		{"log -- src", "log abc..HEAD -- src"},
+		{"log -- a -- b", "log abc..HEAD -- a -- b"},
+	} {
+		if got := strings.Join(beforeDashes(strings.Fields(c.args), "abc..HEAD"), " "); got != c.want {
+			t.Errorf("%q became %q, want %q", c.args, got, c.want)
+		}
+	}
+}
+
+func TestLogSinceRev(t *testing.T) {
+	root := diskTree(t)
+	for _, r := range []*Repo{root, &root.Externals[1]} {
+		if err := os.MkdirAll(filepath.Join(r.Path, ".git", "svn"), 0770); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fakeGit(t, `case "$1 $2" in "svn find-rev") basename "$PWD";; *) echo "git $*";; esac`)
+
+	var err error
+	out := captureStdout(t, func() { err = cmdGitLog(strings.Fields("log --since r100 --oneline -- src"), root) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	// libs/b and libs/a/inner aren't git-svn repos.
+	if strings.Count(out, "git log") != 2 ||
+		!strings.Contains(out, "git log --oneline "+filepath.Base(root.Path)+"..HEAD -- src\n") ||
+		!strings.Contains(out, "git log --oneline a..HEAD -- src\n") {
+		t.Errorf("ran\n%s", out)
+	}
+}
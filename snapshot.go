@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Version of the snapshot format. Bump it when the fields change.
+const snapshotVersion = 1
+
+// A Snapshot records the commit checked out in every repo of the tree, to
+// check the same commits out again later.
+type Snapshot struct {
+	Version int
+	Repos   []SnapshotRepo
+}
+
+type SnapshotRepo struct {
+	Path   string // Relative to the root, "." for the root
+	Url    string
+	Commit string
+	SvnRev string `json:",omitempty"` // git-svn repos only
+}
+
+// Record the commit of every repo in the tree that is on disk.
+func (repo *Repo) Snapshot() (*Snapshot, error) {
+	s := &Snapshot{Version: snapshotVersion}
+	for _, r := range repo.Repos() {
+		if !IsRepo(r.Path) {
+			fmt.Fprintf(os.Stderr, "Repo %s is missing, leaving it out of the snapshot.\n", r.Path)
+			continue
+		}
+		out, err := execCmdCapture(r.Path, "git", "rev-parse", "HEAD")
+		if err != nil {
+			return nil, fmt.Errorf("git rev-parse HEAD failed in %s: %v", r.Path, err)
+		}
+
+		rel := RootRelative(r, "")
+		if rel == "" {
+			rel = "."
+		}
+		entry := SnapshotRepo{Path: rel, Url: r.Url, Commit: strings.TrimSpace(string(out))}
+		if isGitSvn(r.Path) {
+			out, err := execCmdCapture(r.Path, "git", "svn", "find-rev", "HEAD")
+			if rev := strings.TrimSpace(string(out)); err == nil && svnRevRegex.MatchString(rev) {
+				entry.SvnRev = rev
+			}
+		}
+		s.Repos = append(s.Repos, entry)
+	}
+	return s, nil
+}
+
+// Check out the commits of a snapshot, detached, in the repos of the tree.
+// Repos with local changes are skipped with a warning.
+func (repo *Repo) Restore(s *Snapshot) error {
+	var failed int
+	for _, entry := range s.Repos {
+		repoPath := path.Join(repo.Path, entry.Path)
+		if !IsRepo(repoPath) {
+			fmt.Fprintf(os.Stderr, "Repo %s is missing, not restoring it.\n", repoPath)
+			failed++
+			continue
+		}
+		changes, err := gitStatusPorcelain(repoPath)
+		if err != nil {
+			return err
+		}
+		if len(changes) > 0 {
+			fmt.Fprintf(os.Stderr, "Repo %s has local changes, not restoring it.\n", repoPath)
+			failed++
+			continue
+		}
+
+		_, err = execCmdCapture(repoPath, "git", "checkout", "-q", "--detach", entry.Commit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "git checkout %s failed in %s: %v\n", entry.Commit, repoPath, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Repo %s: %s\n", repoPath, entry.Commit)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d repo(s) weren't restored", failed)
+	}
+	return nil
+}
+
+func cmdSnapshot(args []string, repo *Repo) error {
+	flags := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish snapshot [file]\n")
+		fmt.Fprint(os.Stderr, "\tRecord the commit and svn revision of every repo, for 'gish restore'.\n")
+		fmt.Fprint(os.Stderr, "\tThe snapshot is written to stdout if no file is given.\n")
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		return &UsageError{flags.Usage, "Too many arguments."}
+	}
+
+	s, err := repo.Snapshot()
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if flags.NArg() == 0 {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return fsys.WriteFile(flags.Arg(0), b, 0660)
+}
+
+func cmdRestore(args []string, repo *Repo) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish restore <file>\n")
+		fmt.Fprint(os.Stderr, "\tCheck out the commits recorded by 'gish snapshot' in every repo.\n")
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return &UsageError{flags.Usage, "A single snapshot file is required."}
+	}
+
+	b, err := fsys.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("Bad snapshot %s: %v", flags.Arg(0), err)
+	}
+	if s.Version != snapshotVersion {
+		return fmt.Errorf("Snapshot %s is version %d, this gish reads version %d",
+			flags.Arg(0), s.Version, snapshotVersion)
+	}
+	return repo.Restore(&s)
+}
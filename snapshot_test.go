@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func headCommit(t *testing.T, dir string) string {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	dir := t.TempDir()
+	root := &Repo{Path: dir}
+	root.LinkRoot()
+	root.Externals = []Repo{{Path: filepath.Join(dir, "libs", "b"), Root: root}}
+	for _, d := range []string{dir, root.Externals[0].Path} {
+		if err := os.MkdirAll(d, 0770); err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, d, "init", "-q")
+		runGit(t, d, "commit", "-q", "--allow-empty", "-m", "first")
+	}
+	// As gish does when it clones the externals.
+	if err := os.WriteFile(filepath.Join(dir, ".git", "info", "exclude"), []byte("/libs/\n"), 0660); err != nil {
+		t.Fatal(err)
+	}
+	root.Externals = append(root.Externals, Repo{Path: filepath.Join(dir, "missing"), Root: root})
+
+	var s *Snapshot
+	captureOutput(t, &os.Stderr, func() {
+		var err error
+		if s, err = root.Snapshot(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if len(s.Repos) != 2 || s.Repos[0].Path != "." || s.Repos[1].Path != "libs/b" {
+		t.Fatalf("snapshot is %+v", s)
+	}
+
+	b := root.Externals[0].Path
+	runGit(t, b, "commit", "-q", "--allow-empty", "-m", "second")
+	captureStdout(t, func() {
+		if err := root.Restore(s); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if got := headCommit(t, b); got != s.Repos[1].Commit {
+		t.Errorf("restored %s to %s, want %s", b, got, s.Repos[1].Commit)
+	}
+
+	if err := os.WriteFile(filepath.Join(b, "new"), nil, 0660); err != nil {
+		t.Fatal(err)
+	}
+	captureOutput(t, &os.Stderr, func() {
+		if err := root.Restore(s); err == nil {
+			t.Error("restoring over local changes wasn't an error")
+		}
+	})
+}
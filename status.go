@@ -0,0 +1,251 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Version of the porcelain output format. Bump it when the fields change.
+const porcelainVersion = 1
+
+// Repo states reported in porcelain output.
+const (
+	statePresent = "present"
+	stateMissing = "missing"
+	stateClean   = "clean"
+	stateDirty   = "dirty"
+)
+
+// Return the lines of 'git status --porcelain' for the repo. No lines means
+// the working tree is clean.
+func gitStatusPorcelain(repoPath string) ([]string, error) {
+	out, err := execCmdCombinedOutput(repoPath, "git", "status", "--porcelain")
+	if err != nil {
+		return nil, fmt.Errorf("git status failed in %s: %v", repoPath, err)
+	}
+	return parseStatusPorcelain(string(out)), nil
+}
+
+func parseStatusPorcelain(out string) []string {
+	var changes []string
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) != "" {
+			changes = append(changes, line)
+		}
+	}
+	return changes
+}
+
+// States already found by Status, by repo path. Running git status is slow
+// in large repos so it's only done once per run.
+var statusCache = struct {
+	sync.Mutex
+	states map[string]string
+}{states: make(map[string]string)}
+
+// Forget the states found so far.
+func resetStatusCache() {
+	statusCache.Lock()
+	defer statusCache.Unlock()
+	statusCache.states = make(map[string]string)
+}
+
+// Return the working tree state of the repo: clean, dirty or missing.
+func (repo *Repo) Status() (string, error) {
+	statusCache.Lock()
+	state, ok := statusCache.states[repo.Path]
+	statusCache.Unlock()
+	if ok {
+		return state, nil
+	}
+
+	state = stateMissing
+	if IsRepo(repo.Path) {
+		changes, err := gitStatusPorcelain(repo.Path)
+		if err != nil {
+			return "", err
+		}
+
+		state = stateClean
+		if len(changes) > 0 {
+			state = stateDirty
+		}
+	}
+
+	statusCache.Lock()
+	statusCache.states[repo.Path] = state
+	statusCache.Unlock()
+	return state, nil
+}
+
+// Write the porcelain header followed by one path, url, state record per repo.
+func writePorcelain(w io.Writer, repos []*Repo, state func(*Repo) (string, error)) error {
+	fmt.Fprintf(w, "# gish porcelain v%d\n", porcelainVersion)
+	for _, r := range repos {
+		s, err := state(r)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.Path, r.Url, s)
+	}
+	return nil
+}
+
+// The list state only checks that the repo is on disk.
+func listState(r *Repo) (string, error) {
+	if IsRepo(r.Path) {
+		return statePresent, nil
+	}
+	return stateMissing, nil
+}
+
+func statusState(r *Repo) (string, error) {
+	return r.Status()
+}
+
+func cmdList(args []string, repo *Repo) error {
+	var porcelain, flat, missing bool
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	flags.BoolVar(&porcelain, "porcelain", false, "Give the output in a stable, easy-to-parse format.")
+	flags.BoolVar(&flat, "flat", false, "List the full path of each repo rather than a tree.")
+	flags.BoolVar(&missing, "missing", false, "List only the repos in the config that aren't checked out.")
+	flags.StringVar(&externalsRev, "externals-rev", "", "List the externals the root had at this svn revision, from svn rather than the config.")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish list [options]\n")
+		fmt.Fprint(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+
+	if externalsRev != "" {
+		// Read into a new tree so the stored config is left alone.
+		repo = &Repo{Path: repo.Path, Url: repo.Url}
+		repo.Root = repo
+		if err := repo.LoadExternals(); err != nil {
+			return err
+		}
+	}
+
+	if porcelain {
+		return writePorcelain(os.Stdout, repo.Repos(), listState)
+	}
+
+	if missing {
+		listMissing(repo.Repos())
+		return nil
+	}
+
+	if flat {
+		repo.List()
+	} else {
+		repo.ListTree()
+	}
+	return nil
+}
+
+// Print the repos that aren't checked out, such as externals whose clone
+// failed or was interrupted.
+func listMissing(repos []*Repo) {
+	var n int
+	for _, r := range repos {
+		if !IsRepo(r.Path) {
+			fmt.Println(r.Path)
+			n++
+		}
+	}
+	if n > 0 {
+		fmt.Fprintln(os.Stderr, "Run 'gish sync' to clone them.")
+	}
+}
+
+// Return how many svn revisions changed the repo's url after the revision
+// its HEAD was fetched at, and that revision.
+func (repo *Repo) svnBehind() (behind, local int, err error) {
+	lastChanged, err := GitSvnInfo(repo.Path, "Last Changed Rev")
+	if err != nil {
+		return 0, 0, err
+	}
+	local, err = strconv.Atoi(lastChanged)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Bad revision %q in git svn info of %s", lastChanged, repo.Path)
+	}
+
+	lastChanged, err = SvnInfo(repo.Url, "Last Changed Rev")
+	if err != nil {
+		return 0, local, err
+	}
+	remote, err := strconv.Atoi(lastChanged)
+	if err != nil {
+		return 0, local, fmt.Errorf("Bad revision %q in svn info of %s", lastChanged, repo.Url)
+	}
+	if remote <= local {
+		return 0, local, nil
+	}
+
+	out, err := execCmdEnv("", cLocale, "svn", "log", "-q", "-r",
+		fmt.Sprintf("%d:%d", local+1, remote), repo.Url)
+	if err != nil {
+		return 0, local, fmt.Errorf("svn log %s failed (%s)", repo.Url, err)
+	}
+	return len(svnLogRevRegex.FindAll(out, -1)), local, nil
+}
+
+// Print how many svn revisions each git-svn repo is behind, asking the
+// server rather than fetching.
+func printBehind(repos []*Repo) error {
+	var failed int
+	for _, r := range repos {
+		switch {
+		case !IsRepo(r.Path):
+			fmt.Printf("%s: %s\n", r.Label(), stateMissing)
+		case !isGitSvn(r.Path):
+			fmt.Printf("%s: not a git-svn repo\n", r.Label())
+		default:
+			behind, local, err := r.svnBehind()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				failed++
+			} else if behind == 0 {
+				fmt.Printf("%s: up to date at r%d\n", r.Label(), local)
+			} else {
+				fmt.Printf("%s: %d svn revisions behind r%d\n", r.Label(), behind, local)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("Couldn't check %d repos against svn", failed)
+	}
+	return nil
+}
+
+// Report whether a status command line is meant for gish rather than git.
+func isGishStatus(args []string) bool {
+	if len(args) != 2 {
+		return false
+	}
+	switch args[1] {
+	case "--porcelain", "-porcelain", "--fetch", "-fetch":
+		return true
+	}
+	return false
+}
+
+// Print the porcelain status of every repo, or with --fetch how far behind
+// svn each is. Other status invocations are passed to git.
+func cmdStatus(args []string, repo *Repo) error {
+	if !isGishStatus(args) {
+		return Foreach(repo.Repos(), args)
+	}
+	if strings.HasSuffix(args[1], "fetch") {
+		return printBehind(repo.Repos())
+	}
+	return writePorcelain(os.Stdout, repo.Repos(), statusState)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWritePorcelain(t *testing.T) {
+	useMemFS(t)
+	makeRepo(t, "/tree/root")
+	makeRepo(t, "/tree/root/libs/b")
+
+	var out bytes.Buffer
+	if err := writePorcelain(&out, testTree().Repos(), listState); err != nil {
+		t.Fatal(err)
+	}
+	want := "# gish porcelain v1\n" +
+		"/tree/root\thttps://svn.example.com/repo/trunk\tpresent\n" +
+		"/tree/root/libs/b\thttps://svn.example.com/repo/libs/b\tpresent\n" +
+		"/tree/root/libs/a\tsvn://other.example.com/a\tmissing\n" +
+		"/tree/root/libs/a/inner\tsvn://other.example.com/inner\tmissing\n"
+	if out.String() != want {
+		t.Errorf("porcelain output is\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestPrintBehind(t *testing.T) {
+	root := diskTree(t)
+	b, a := &root.Externals[0], &root.Externals[1]
+	for _, r := range []*Repo{root, b} {
+		if err := os.MkdirAll(filepath.Join(r.Path, ".git", "svn"), 0770); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(a.Path, ".git")); err != nil {
+		t.Fatal(err)
+	}
+	fakeGit(t, `echo 'Last Changed Rev: 100'`)
+	fakeCommand(t, "svn", `case "$1:$2:$4" in
+info:*/libs/b:) echo 'Last Changed Rev: 90';;
+info:*) echo 'Last Changed Rev: 105';;
+log:-q:101:105) echo 'r101 | alice | date'; echo 'r104 | bob | date';;
+*) exit 1;;
+esac`)
+	var err error
+	out := captureStdout(t, func() { err = printBehind(root.Repos()) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := root.Label() + ": 2 svn revisions behind r100\n" +
+		b.Label() + ": up to date at r100\n" +
+		a.Label() + ": " + stateMissing + "\n" +
+		a.Externals[0].Label() + ": not a git-svn repo\n"
+	if out != want {
+		t.Errorf("printed\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestListTree(t *testing.T) {
+	root := testTree()
+	root.Externals = append(root.Externals, Repo{Path: "/tree/root/tools", Url: "https://svn.example.com/repo/tools"})
+	root.LinkRoot()
+	want := "/tree/root\n" +
+		"├── libs/b\n" +
+		"├── libs/a\n" +
+		"│   └── libs/a/inner\n" +
+		"└── tools\n"
+	if got := captureStdout(t, root.ListTree); got != want {
+		t.Errorf("listed\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestListMissing(t *testing.T) {
+	useMemFS(t)
+	root := testTree()
+	makeRepo(t, root.Path)
+	makeRepo(t, root.Externals[1].Path)
+
+	var out string
+	stderr := captureOutput(t, &os.Stderr, func() {
+		out = captureStdout(t, func() { listMissing(root.Repos()) })
+	})
+	if want := "/tree/root/libs/b\n/tree/root/libs/a/inner\n"; out != want {
+		t.Errorf("listed %q, want %q", out, want)
+	}
+	if stderr == "" {
+		t.Error("no hint to sync the missing repos")
+	}
+
+	makeRepo(t, root.Externals[0].Path)
+	makeRepo(t, root.Externals[1].Externals[0].Path)
+	stderr = captureOutput(t, &os.Stderr, func() {
+		out = captureStdout(t, func() { listMissing(root.Repos()) })
+	})
+	if out != "" || stderr != "" {
+		t.Errorf("nothing missing printed %q and %q", out, stderr)
+	}
+}
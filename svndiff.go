@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+var svnIndexRule = strings.Repeat("=", 67)
+
+// Return the label svn diff gives the side of a diff at commit, from the
+// svn revision of the commit.
+func svnRevLabel(repoPath, commit string) string {
+	out, err := execCmdCapture(repoPath, "git", "svn", "find-rev", commit)
+	rev := strings.TrimSpace(string(out))
+	if err != nil || rev == "" {
+		return "(revision 0)"
+	}
+	return "(revision " + rev + ")"
+}
+
+// Reformat git diff output, with a/ and b/ prefixes, as svn diff output so it
+// applies with svn patch. Changes git can show but svn can't, such as mode
+// changes, are left out.
+func gitToSvnDiff(gitDiff []byte, oldLabel, newLabel string) []byte {
+	var out bytes.Buffer
+	var oldPath string
+	inHeader := false
+	for _, line := range strings.SplitAfter(string(gitDiff), "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			inHeader = true
+			oldPath = ""
+		case inHeader && strings.HasPrefix(line, "--- "):
+			oldPath = strings.TrimSpace(strings.TrimPrefix(line, "--- "))
+		case inHeader && strings.HasPrefix(line, "+++ "):
+			newPath := strings.TrimSpace(strings.TrimPrefix(line, "+++ "))
+			oldSide, newSide := oldLabel, newLabel
+			name := stripPatchPrefix(newPath)
+			if oldPath == "/dev/null" {
+				oldSide = "(nonexistent)"
+			}
+			if newPath == "/dev/null" {
+				name = stripPatchPrefix(oldPath)
+				newSide = "(nonexistent)"
+			}
+			fmt.Fprintf(&out, "Index: %s\n%s\n--- %s\t%s\n+++ %s\t%s\n",
+				name, svnIndexRule, name, oldSide, name, newSide)
+			inHeader = false
+		case inHeader && strings.HasPrefix(line, "Binary files "):
+			name := strings.TrimPrefix(line, "Binary files ")
+			if i := strings.Index(name, " and "); i >= 0 {
+				name = name[:i]
+			}
+			fmt.Fprintf(&out, "Index: %s\n%s\nCannot display: file marked as a binary type.\n"+
+				"svn:mime-type = application/octet-stream\n", stripPatchPrefix(name), svnIndexRule)
+			inHeader = false
+		case inHeader:
+			// index, mode and similarity lines have no svn equivalent.
+		default:
+			out.WriteString(line)
+		}
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGitToSvnDiff(t *testing.T) {
+	gitDiff := "diff --git a/src/main.c b/src/main.c\n" +
+		"index 1111111..2222222 100644\n" +
+		"--- a/src/main.c\n" +
+		"+++ b/src/main.c\n" +
+		"@@ -1 +1 @@\n" +
+		"-old\n" +
+		"+new\n" +
+		"diff --git a/added.txt b/added.txt\n" +
+		"new file mode 100644\n" +
+		"--- /dev/null\n" +
+		"+++ b/added.txt\n" +
+		"@@ -0,0 +1 @@\n" +
+		"+added\n" +
+		"diff --git a/gone.txt b/gone.txt\n" +
+		"deleted file mode 100644\n" +
+		"--- a/gone.txt\n" +
+		"+++ /dev/null\n" +
+		"@@ -1 +0,0 @@\n" +
+		"-gone\n" +
+		"diff --git a/tool.sh b/tool.sh\n" +
+		"old mode 100644\n" +
+		"new mode 100755\n" +
+		"diff --git a/logo.png b/logo.png\n" +
+		"index 3333333..4444444 100644\n" +
+		"Binary files a/logo.png and b/logo.png differ\n"
+	want := "Index: src/main.c\n" + svnIndexRule + "\n" +
+		"--- src/main.c\t(revision 7)\n" +
+		"+++ src/main.c\t(working copy)\n" +
+		"@@ -1 +1 @@\n" +
+		"-old\n" +
+		"+new\n" +
+		"Index: added.txt\n" + svnIndexRule + "\n" +
+		"--- added.txt\t(nonexistent)\n" +
+		"+++ added.txt\t(working copy)\n" +
+		"@@ -0,0 +1 @@\n" +
+		"+added\n" +
+		"Index: gone.txt\n" + svnIndexRule + "\n" +
+		"--- gone.txt\t(revision 7)\n" +
+		"+++ gone.txt\t(nonexistent)\n" +
+		"@@ -1 +0,0 @@\n" +
+		"-gone\n" +
+		"Index: logo.png\n" + svnIndexRule + "\n" +
+		"Cannot display: file marked as a binary type.\n" +
+		"svn:mime-type = application/octet-stream\n"
+	if got := string(gitToSvnDiff([]byte(gitDiff), "(revision 7)", "(working copy)")); got != want {
+		t.Errorf("converted to\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDiffSvnFormat(t *testing.T) {
+	root := diskTree(t)
+	// A diff of one file in each repo, refused unless color is turned off
+	// before the other arguments.
+	fakeGit(t, `case "$1" in
+svn) echo 7;;
+diff) [ "$2" = --no-color ] || exit 2
+	p=${3#--src-prefix=a/}
+	printf 'diff --git a/%sf.c b/%sf.c\n--- a/%sf.c\n+++ b/%sf.c\n@@ -1 +1 @@\n-x\n+y\n' $p $p $p $p;;
+esac`)
+
+	var err error
+	out := captureStdout(t, func() { err = cmdDiff([]string{"diff", "--format=svn", "--", "f.c"}, root) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Index: f.c\n",
+		"Index: libs/b/f.c\n",
+		"Index: libs/a/inner/f.c\n",
+		"--- libs/a/f.c\t(revision 7)\n+++ libs/a/f.c\t(working copy)\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("no %q in\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The git-svn fetch configuration of a repo cloned with branches or tags,
+// the values of svn-remote.svn.*, kept so a new clone gets the same layout.
+type SvnRemote struct {
+	Url      string   // svn-remote.svn.url, which the paths are relative to
+	Fetch    []string // Mappings of single paths, such as trunk
+	Branches []string `json:",omitempty"`
+	Tags     []string `json:",omitempty"`
+}
+
+// Return the values of a git config key, none if it isn't set.
+func gitConfigAll(repoPath, key string) []string {
+	out, err := execCmdCapture(repoPath, "git", "config", "--get-all", key)
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.TrimSpace(string(out)), "\n")
+}
+
+// Read the repo's git-svn fetch configuration. nil means it only fetches one
+// path, which the repo's url is enough to clone again.
+func readSvnRemote(repoPath string) *SvnRemote {
+	r := &SvnRemote{
+		Fetch:    gitConfigAll(repoPath, "svn-remote.svn.fetch"),
+		Branches: gitConfigAll(repoPath, "svn-remote.svn.branches"),
+		Tags:     gitConfigAll(repoPath, "svn-remote.svn.tags"),
+	}
+	if len(r.Branches) == 0 && len(r.Tags) == 0 {
+		return nil
+	}
+	if url := gitConfigAll(repoPath, "svn-remote.svn.url"); len(url) > 0 {
+		r.Url = url[0]
+	}
+	return r
+}
+
+// Store the git-svn layout of the repo, if it has branches or tags and
+// isn't known yet.
+func (repo *Repo) recordSvnRemote() {
+	if repo.SvnRemote != nil || repo.Kind != KindGitSvn {
+		return
+	}
+	if r := readSvnRemote(repo.Path); r != nil {
+		// The config may be written by the clone of another external meanwhile.
+		treeMu.Lock()
+		repo.SvnRemote = r
+		treeMu.Unlock()
+	}
+}
+
+// Set the stored git-svn layout in a repo that 'git svn init' has just
+// created, replacing the mappings init made.
+func (repo *Repo) applySvnRemote() error {
+	set := func(key string, values []string) error {
+		execCmdCapture(repo.Path, "git", "config", "--unset-all", key)
+		for _, v := range values {
+			out, err := execCmdCapture(repo.Path, "git", "config", "--add", key, v)
+			if err != nil {
+				return fmt.Errorf("Can't set %s in %s: %v\n%s", key, repo.Path, err, out)
+			}
+		}
+		return nil
+	}
+	r := repo.SvnRemote
+	if err := set("svn-remote.svn.fetch", r.Fetch); err != nil {
+		return err
+	}
+	if err := set("svn-remote.svn.branches", r.Branches); err != nil {
+		return err
+	}
+	return set("svn-remote.svn.tags", r.Tags)
+}
+
+// Return the url 'git svn init' is given for the repo.
+func (repo *Repo) initUrl() string {
+	if repo.SvnRemote != nil && repo.SvnRemote.Url != "" {
+		return repo.SvnRemote.Url
+	}
+	return repo.Url
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestSvnRemoteRoundTrip(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	src := t.TempDir()
+	runGit(t, src, "init", "-q")
+	runGit(t, src, "config", "svn-remote.svn.url", "https://svn.example.com/repo")
+	runGit(t, src, "config", "svn-remote.svn.fetch", "trunk:refs/remotes/origin/trunk")
+	if r := readSvnRemote(src); r != nil {
+		t.Errorf("a repo fetching only trunk has layout %+v", r)
+	}
+
+	runGit(t, src, "config", "--add", "svn-remote.svn.branches", "branches/*:refs/remotes/origin/*")
+	runGit(t, src, "config", "--add", "svn-remote.svn.tags", "tags/*:refs/remotes/origin/tags/*")
+	want := &SvnRemote{
+		Url:      "https://svn.example.com/repo",
+		Fetch:    []string{"trunk:refs/remotes/origin/trunk"},
+		Branches: []string{"branches/*:refs/remotes/origin/*"},
+		Tags:     []string{"tags/*:refs/remotes/origin/tags/*"},
+	}
+	if got := readSvnRemote(src); !reflect.DeepEqual(got, want) {
+		t.Fatalf("layout is %+v, want %+v", got, want)
+	}
+
+	// As git svn init leaves a clone of the trunk url.
+	dest := &Repo{Path: t.TempDir(), Url: "https://svn.example.com/repo/trunk", SvnRemote: want}
+	runGit(t, dest.Path, "init", "-q")
+	runGit(t, dest.Path, "config", "svn-remote.svn.url", dest.initUrl())
+	runGit(t, dest.Path, "config", "svn-remote.svn.fetch", ":refs/remotes/git-svn")
+	if err := dest.applySvnRemote(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readSvnRemote(dest.Path); !reflect.DeepEqual(got, want) {
+		t.Errorf("applied layout is %+v, want %+v", got, want)
+	}
+	if got := (&Repo{Url: dest.Url}).initUrl(); got != dest.Url {
+		t.Errorf("a repo without a layout is initialized from %s", got)
+	}
+}
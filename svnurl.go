@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Report whether svn leaves c unescaped in the path of a canonical url.
+func svnPathChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		strings.IndexByte("!$&'()*+,-./:;=@_~", c) >= 0
+}
+
+// Escape an unescaped url path the way svn does.
+func escapeSvnPath(p string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if svnPathChar(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
+
+// Return a parsed url in svn's canonical form, where the path is escaped only
+// where svn escapes it. The same url is then always spelled the same way,
+// whether it was written with spaces or with %20.
+func svnUrlString(u *url.URL) string {
+	s := u.Scheme + "://"
+	if u.User != nil {
+		s += u.User.String() + "@"
+	}
+	s += u.Host + escapeSvnPath(u.Path)
+	if u.RawQuery != "" {
+		s += "?" + u.RawQuery
+	}
+	return s
+}
+
+// Return svnUrl in svn's canonical form, see svnUrlString.
+func canonicalSvnUrl(svnUrl string) (string, error) {
+	u, err := url.Parse(svnUrl)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" {
+		// Not an absolute url, leave it for svn to complain about.
+		return svnUrl, nil
+	}
+	return svnUrlString(u), nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCanonicalSvnUrl(t *testing.T) {
+	for in, want := range map[string]string{
+		"https://svn.example.com/repo/my lib":        "https://svn.example.com/repo/my%20lib",
+		"https://svn.example.com/repo/my%20lib":      "https://svn.example.com/repo/my%20lib",
+		"https://svn.example.com/repo/a+b=c@d":       "https://svn.example.com/repo/a+b=c@d",
+		"https://svn.example.com/repo/100%25#1":      "https://svn.example.com/repo/100%25",
+		"svn://user@svn.example.com/r/caf%C3%A9?x=1": "svn://user@svn.example.com/r/caf%C3%A9?x=1",
+		"libs/b": "libs/b",
+	} {
+		got, err := canonicalSvnUrl(in)
+		if err != nil {
+			t.Errorf("%q: %v", in, err)
+		} else if got != want {
+			t.Errorf("canonical form of %q is %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestJoinUrlPath(t *testing.T) {
+	// joinUrl unescapes rel, joinUrlPath takes it literally.
+	base := "https://svn.example.com/repo/trunk"
+	for _, c := range []struct {
+		join      func(string, string) (string, error)
+		rel, want string
+	}{
+		{joinUrl, "my%20dir/../x y", base + "/x%20y"},
+		{joinUrlPath, "100%20", base + "/100%2520"},
+		{joinUrlPath, "a b", base + "/a%20b"},
+	} {
+		got, err := c.join(base, c.rel)
+		if err != nil {
+			t.Errorf("%q: %v", c.rel, err)
+		} else if got != c.want {
+			t.Errorf("joined %q as %q, want %q", c.rel, got, c.want)
+		}
+	}
+}
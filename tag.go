@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Report whether the git tag exists in the repo at repoPath.
+func tagExists(repoPath, name string) (bool, error) {
+	out, err := execCmdCombinedOutput(repoPath, "git", "tag", "-l", name)
+	if err != nil {
+		return false, fmt.Errorf("git tag -l failed in %s: %v", repoPath, err)
+	}
+	return parseTagList(string(out), name), nil
+}
+
+// Report whether name is one of the tags in git tag -l output.
+func parseTagList(out, name string) bool {
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func cmdTag(args []string, repo *Repo) error {
+	var msg string
+	var forceTag, svnTag bool
+	flags := flag.NewFlagSet("tag", flag.ContinueOnError)
+	flags.StringVar(&msg, "m", "", "Create an annotated tag with the given message.")
+	flags.BoolVar(&forceTag, "force", false, "Move the tag in repos where it already exists.")
+	flags.BoolVar(&svnTag, "svn", false, "Also create the tag in svn with 'git svn tag'.")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish tag [options] <name>\n")
+		fmt.Fprint(os.Stderr, "\tTag the current commit of the repo and each of its externals.\n")
+		fmt.Fprint(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+
+	if len(args) < 2 {
+		return &UsageError{flags.Usage, "Not enough arguments to 'gish tag'."}
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return &UsageError{flags.Usage, "A single tag name is required."}
+	}
+	name := flags.Arg(0)
+
+	var toTag []*Repo
+	var existing []string
+	for _, r := range repo.Repos() {
+		exists, err := tagExists(r.Path, name)
+		if err != nil {
+			return err
+		}
+
+		if exists && !forceTag {
+			existing = append(existing, r.Path)
+			continue
+		}
+		toTag = append(toTag, r)
+	}
+
+	tagArgs := []string{"tag"}
+	if forceTag {
+		tagArgs = append(tagArgs, "-f")
+	}
+	if msg != "" {
+		tagArgs = append(tagArgs, "-a", "-m", msg)
+	}
+	failedRepos, err := ForeachFailed(toTag, append(tagArgs, name))
+	if err != nil {
+		return err
+	}
+
+	if svnTag {
+		// Only tag in svn what was tagged in git.
+		failed := make(map[*Repo]bool, len(failedRepos))
+		for _, r := range failedRepos {
+			failed[r] = true
+		}
+		var tagged []*Repo
+		for _, r := range toTag {
+			if !failed[r] {
+				tagged = append(tagged, r)
+			}
+		}
+
+		svnArgs := []string{"svn", "tag"}
+		if msg != "" {
+			svnArgs = append(svnArgs, "-m", msg)
+		}
+		svnFailed, err := ForeachFailed(tagged, append(svnArgs, name))
+		if err != nil {
+			return err
+		}
+		failedRepos = append(failedRepos, svnFailed...)
+	}
+
+	if len(existing) > 0 {
+		for _, p := range existing {
+			fmt.Fprintf(os.Stderr, "Tag %s already exists in %s\n", name, p)
+		}
+		return fmt.Errorf("Tag %s exists in %d repo(s), use -force to move it.", name, len(existing))
+	}
+	if len(failedRepos) > 0 {
+		return fmt.Errorf("Tagging %s failed in %d repo(s)", name, len(failedRepos))
+	}
+	return nil
+}
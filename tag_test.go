@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestParseTagList(t *testing.T) {
+	out := "v1.0\nv1.0-rc1\n  release/2\n"
+	for name, want := range map[string]bool{
+		"v1.0":      true,
+		"release/2": true,
+		"v1":        false,
+		"rc1":       false,
+	} {
+		if got := parseTagList(out, name); got != want {
+			t.Errorf("parseTagList(%q) = %v, want %v", name, got, want)
+		}
+	}
+	if parseTagList("", "v1.0") {
+		t.Error("found a tag in empty output")
+	}
+}
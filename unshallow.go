@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Return the oldest svn revision fetched into a git-svn repo.
+func firstFetchedRev(repoPath string) (int, error) {
+	out, err := execCmdCapture(repoPath, "git", "rev-list", "--max-parents=0", "HEAD")
+	if err != nil {
+		return 0, fmt.Errorf("Can't find the first commit of %s: %v", repoPath, err)
+	}
+
+	first := 0
+	for _, commit := range strings.Fields(string(out)) {
+		revOut, err := execCmdCapture(repoPath, "git", "svn", "find-rev", commit)
+		if err != nil {
+			continue
+		}
+		rev, err := strconv.Atoi(strings.TrimSpace(string(revOut)))
+		if err != nil {
+			continue
+		}
+		if first == 0 || rev < first {
+			first = rev
+		}
+	}
+	if first == 0 {
+		return 0, fmt.Errorf("No svn revision found for the first commit of %s", repoPath)
+	}
+	return first, nil
+}
+
+var svnLogRevRegex = regexp.MustCompile(`(?m)^r(\d+) \|`)
+
+// Return the oldest revision in the history of an svn url.
+func firstSvnRev(svnUrl string) (int, error) {
+	out, err := execCmdEnv("", cLocale, "svn", "log", "-q", "-r", "1:HEAD", "-l", "1", svnUrl)
+	if err != nil {
+		return 0, fmt.Errorf("svn log %s failed (%s)", svnUrl, err)
+	}
+	m := svnLogRevRegex.FindSubmatch(out)
+	if m == nil {
+		return 0, fmt.Errorf("No revisions in svn log of %s", svnUrl)
+	}
+	return strconv.Atoi(string(m[1]))
+}
+
+func countCommits(repoPath string) int {
+	out, err := execCmdCapture(repoPath, "git", "rev-list", "--count", "--all")
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(string(bytes.TrimSpace(out)))
+	return n
+}
+
+// Fetch the svn history missing from repos that were cloned from a later
+// revision. Repos that already have their full history are skipped.
+func Unshallow(repos []*Repo) error {
+	var failed int
+	for _, r := range repos {
+		err := r.unshallow()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Repo %s: %v\n", r.Path, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d repo(s) couldn't be unshallowed", failed)
+	}
+	return nil
+}
+
+func (repo *Repo) unshallow() error {
+	if !isGitSvn(repo.Path) {
+		fmt.Printf("Repo %s: not a git-svn repo, skipped.\n", repo.Path)
+		return nil
+	}
+
+	fetched, err := firstFetchedRev(repo.Path)
+	if err != nil {
+		return err
+	}
+	first, err := firstSvnRev(repo.Url)
+	if err != nil {
+		return err
+	}
+	if fetched <= first {
+		fmt.Printf("Repo %s: full history from r%d.\n", repo.Path, first)
+		return nil
+	}
+
+	fmt.Printf("Repo %s: history starts at r%d, fetching from r%d.\n", repo.Path, fetched, first)
+	before := countCommits(repo.Path)
+	err = execCmd(repo.Path, "git", "svn", "fetch", "-r", fmt.Sprintf("%d:HEAD", first))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Repo %s: fetched %d revisions.\n", repo.Path, countCommits(repo.Path)-before)
+	return nil
+}
+
+func cmdUnshallow(args []string, repo *Repo) error {
+	flags := flag.NewFlagSet("unshallow", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish unshallow\n")
+		fmt.Fprint(os.Stderr, "\nFetch the svn history missing from repos cloned from a later revision.\n")
+	}
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return &UsageError{flags.Usage, "unshallow takes no arguments."}
+	}
+
+	return Unshallow(repo.Repos())
+}
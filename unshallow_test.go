@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFirstFetchedRev(t *testing.T) {
+	fakeGit(t, `case "$1 $3" in
+"rev-list HEAD") echo aaa; echo bbb; echo ccc;;
+"svn aaa") echo 120;;
+"svn bbb") echo 95;;
+*) exit 1;;
+esac`)
+	if rev, err := firstFetchedRev(t.TempDir()); err != nil || rev != 95 {
+		t.Errorf("first fetched rev %d, %v", rev, err)
+	}
+
+	fakeGit(t, `case "$1" in rev-list) echo aaa;; *) echo;; esac`)
+	if _, err := firstFetchedRev(t.TempDir()); err == nil {
+		t.Error("found a revision in a repo without svn commits")
+	}
+}
+
+func TestFirstSvnRev(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho '------------------------------------------------------------------------'\n" +
+		"echo 'r42 | alice | 2020-01-02 03:04:05 +0000 (Thu, 02 Jan 2020)'\n" +
+		"echo '------------------------------------------------------------------------'\n"
+	if err := os.WriteFile(filepath.Join(dir, "svn"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	if rev, err := firstSvnRev("https://svn.example.com/repo/trunk"); err != nil || rev != 42 {
+		t.Errorf("first svn rev %d, %v", rev, err)
+	}
+}
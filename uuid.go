@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+)
+
+// A repo whose svn repository now has a different UUID than the one stored
+// in the config, which happens when it is re-created upstream. git-svn fails
+// in confusing ways on such a repo.
+type UUIDChangedError struct {
+	Path, Url    string
+	Stored, Live string
+}
+
+func (e *UUIDChangedError) Error() string {
+	return fmt.Sprintf("Repository UUID changed for %s: the config has %s but %s reports %s. "+
+		"The svn repository was re-created, clone the repo again.", e.Path, e.Stored, e.Url, e.Live)
+}
+
+// Store the UUID of the repo's svn repository, if it isn't known yet.
+func (repo *Repo) recordUUID() {
+	if repo.UUID != "" || repo.Kind != KindGitSvn {
+		return
+	}
+	if uuid, err := GitSvnInfo(repo.Path, "Repository UUID"); err == nil {
+		// The config may be written by the clone of another external meanwhile.
+		treeMu.Lock()
+		repo.UUID = uuid
+		treeMu.Unlock()
+	}
+}
+
+// Check that the svn server still reports the repository UUID stored for the
+// repo. A server that can't be asked isn't an error here, the update that
+// follows will report it.
+func (repo *Repo) checkUUID() error {
+	if repo.UUID == "" {
+		return nil
+	}
+	live, err := SvnInfo(repo.Url, "Repository UUID")
+	if err != nil {
+		return nil
+	}
+	if live != repo.UUID {
+		return &UUIDChangedError{repo.Path, repo.Url, repo.UUID, live}
+	}
+	return nil
+}
+
+// Check the UUIDs of all the repos before an update, recording those that
+// aren't known yet.
+func checkUUIDs(repos []*Repo) error {
+	for _, r := range repos {
+		if err := r.checkUUID(); err != nil {
+			return err
+		}
+		r.recordUUID()
+	}
+	return nil
+}
+
+// Report whether git args fetch from svn.
+func isSvnUpdate(args []string) bool {
+	return len(args) > 1 && args[0] == "svn" && (args[1] == "rebase" || args[1] == "fetch")
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckUUID(t *testing.T) {
+	repo := &Repo{Path: "/tree/root", Url: "https://svn.example.com/repo/trunk", UUID: "1111"}
+	fakeCommand(t, "svn", "echo 'Repository UUID: 2222'")
+	err := repo.checkUUID()
+	changed, ok := err.(*UUIDChangedError)
+	if !ok || changed.Stored != "1111" || changed.Live != "2222" {
+		t.Fatalf("a re-created repository gave %v", err)
+	}
+	if !strings.Contains(err.Error(), repo.Path) {
+		t.Errorf("the error doesn't name the repo: %v", err)
+	}
+
+	repo.UUID = "2222"
+	if err := repo.checkUUID(); err != nil {
+		t.Errorf("the same UUID gave %v", err)
+	}
+	repo.UUID = ""
+	if err := repo.checkUUID(); err != nil {
+		t.Errorf("an unknown UUID gave %v", err)
+	}
+
+	repo.UUID = "1111"
+	fakeCommand(t, "svn", "echo 'svn: E170013: Unable to connect' >&2; exit 1")
+	if err := repo.checkUUID(); err != nil {
+		t.Errorf("an unreachable server gave %v", err)
+	}
+}
+
+func TestIsSvnUpdate(t *testing.T) {
+	for args, want := range map[string]bool{
+		"svn rebase":      true,
+		"svn fetch --all": true,
+		"svn dcommit":     false,
+		"fetch":           false,
+		"svn":             false,
+	} {
+		if got := isSvnUpdate(strings.Fields(args)); got != want {
+			t.Errorf("isSvnUpdate(%q) is %v", args, got)
+		}
+	}
+}
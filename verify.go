@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Check that an svn url can be reached, without prompting for credentials.
+// The error holds the first line of svn's message.
+func checkUrl(svnUrl string) error {
+	out, err := execCmdCapture("", "svn", "info", "--non-interactive", svnUrl)
+	if err == nil {
+		return nil
+	}
+	if line := bytes.TrimSpace(bytes.SplitN(bytes.TrimSpace(out), []byte("\n"), 2)[0]); len(line) > 0 {
+		return fmt.Errorf("%s", line)
+	}
+	return err
+}
+
+// Check each distinct url in the tree once, -j at a time and at most
+// -jobs-per-server on each server, and print the results by server.
+func (repo *Repo) VerifyUrls() error {
+	servers := Servers(repo.Repos())
+	results := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	t := newThrottle(jobs, jobsPerServer)
+	for _, server := range servers {
+		for _, r := range server.Repos {
+			mu.Lock()
+			_, seen := results[r.Url]
+			results[r.Url] = nil
+			mu.Unlock()
+			if seen {
+				continue
+			}
+
+			wg.Add(1)
+			go func(r *Repo) {
+				defer wg.Done()
+				release := t.acquire(r)
+				err := checkUrl(r.Url)
+				release()
+				mu.Lock()
+				results[r.Url] = err
+				mu.Unlock()
+			}(r)
+		}
+	}
+	wg.Wait()
+
+	var failed int
+	for _, server := range servers {
+		fmt.Println(server.Root)
+		printed := make(map[string]bool)
+		for _, r := range server.Repos {
+			if printed[r.Url] {
+				continue
+			}
+			printed[r.Url] = true
+			if err := results[r.Url]; err != nil {
+				fmt.Printf("\tunreachable\t%s: %v\n", r.Url, err)
+				failed++
+			} else {
+				fmt.Printf("\tok\t%s\n", r.Url)
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d url(s) unreachable", failed, len(results))
+	}
+	return nil
+}
+
+func cmdVerifyUrls(args []string, repo *Repo) error {
+	flags := flag.NewFlagSet("verify-urls", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish verify-urls\n")
+		fmt.Fprint(os.Stderr, "\tCheck that the svn url of every repo in the tree can be reached.\n")
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	return repo.VerifyUrls()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyUrls(t *testing.T) {
+	root := testTree()
+	// libs/b is listed twice, it is checked once.
+	root.Externals = append(root.Externals, Repo{Path: "/tree/root/also/b", Url: root.Externals[0].Url})
+	root.LinkRoot()
+	calls := filepath.Join(t.TempDir(), "calls")
+	fakeCommand(t, "svn", `echo "$3" >> `+calls+`
+case "$3" in svn://other.example.com/a) echo "svn: E170013: Unable to connect" >&2; echo "more" >&2; exit 1;; esac`)
+
+	var err error
+	out := captureStdout(t, func() { err = root.VerifyUrls() })
+	if err == nil || err.Error() != "1 of 4 url(s) unreachable" {
+		t.Errorf("returned %v", err)
+	}
+	want := "https://svn.example.com\n" +
+		"\tok\thttps://svn.example.com/repo/trunk\n" +
+		"\tok\thttps://svn.example.com/repo/libs/b\n" +
+		"svn://other.example.com\n" +
+		"\tunreachable\tsvn://other.example.com/a: svn: E170013: Unable to connect\n" +
+		"\tok\tsvn://other.example.com/inner\n"
+	if out != want {
+		t.Errorf("printed\n%s\nwant\n%s", out, want)
+	}
+
+	b, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), root.Externals[0].Url); n != 1 {
+		t.Errorf("%s was checked %d times", root.Externals[0].Url, n)
+	}
+}
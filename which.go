@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Return the repo in the tree that a local path belongs to, the deepest repo
+// whose directory contains it, and the path relative to that repo.
+func (repo *Repo) Owner(localPath string) (*Repo, string, error) {
+	abs, err := filepath.Abs(localPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var owner *Repo
+	var rel string
+	for _, r := range repo.Repos() {
+		p, err := filepath.Rel(r.Path, abs)
+		if err != nil || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if owner == nil || len(r.Path) > len(owner.Path) {
+			owner, rel = r, filepath.ToSlash(p)
+		}
+	}
+	if owner == nil {
+		return nil, "", fmt.Errorf("%s isn't in the tree at %s", localPath, repo.Path)
+	}
+	if rel == "." {
+		rel = ""
+	}
+	return owner, rel, nil
+}
+
+// Return the svn url of a local path in the tree.
+func (repo *Repo) SvnUrlOf(localPath string) (string, error) {
+	owner, rel, err := repo.Owner(localPath)
+	if err != nil {
+		return "", err
+	}
+	if rel == "" {
+		return owner.Url, nil
+	}
+	return joinUrlPath(owner.Url, rel)
+}
+
+func cmdWhich(args []string, repo *Repo) error {
+	flags := flag.NewFlagSet("which", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish which <path>\n")
+		fmt.Fprint(os.Stderr, "\nPrint the repo in the tree that the path belongs to.\n")
+	}
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return &UsageError{flags.Usage, "which needs a path."}
+	}
+
+	owner, _, err := repo.Owner(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Println(owner.Path)
+	return nil
+}
+
+func cmdOpen(args []string, repo *Repo) error {
+	var browser bool
+	flags := flag.NewFlagSet("open", flag.ContinueOnError)
+	flags.BoolVar(&browser, "browser", false, "Open the url in the web browser as well.")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish open [options] <path>\n")
+		fmt.Fprint(os.Stderr, "\nPrint the svn url of a file or directory in the tree.\n")
+		fmt.Fprint(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return &UsageError{flags.Usage, "open needs a path."}
+	}
+
+	svnUrl, err := repo.SvnUrlOf(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Println(svnUrl)
+
+	if browser {
+		opener := "xdg-open"
+		switch runtime.GOOS {
+		case "darwin":
+			opener = "open"
+		case "windows":
+			return execCmd("", "cmd", "/c", "start", svnUrl)
+		}
+		return execCmd("", opener, svnUrl)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestOwner(t *testing.T) {
+	root := testTree()
+	for _, c := range []struct{ path, owner, rel string }{
+		{"/tree/root", "/tree/root", ""},
+		{"/tree/root/libs/a/inner/src/x.c", "/tree/root/libs/a/inner", "src/x.c"},
+		{"/tree/root/libs/a/", "/tree/root/libs/a", ""},
+		{"/tree/root/libs/ab", "/tree/root", "libs/ab"},
+	} {
+		owner, rel, err := root.Owner(c.path)
+		if err != nil {
+			t.Errorf("%s: %v", c.path, err)
+		} else if owner.Path != c.owner || rel != c.rel {
+			t.Errorf("%s belongs to %s as %q, want %s as %q", c.path, owner.Path, rel, c.owner, c.rel)
+		}
+	}
+	if _, _, err := root.Owner("/tree/other"); err == nil {
+		t.Error("a path outside the tree has an owner")
+	}
+}
+
+func TestSvnUrlOf(t *testing.T) {
+	root := testTree()
+	for p, want := range map[string]string{
+		"/tree/root":                      "https://svn.example.com/repo/trunk",
+		"/tree/root/libs/a/inner/src/x.c": "svn://other.example.com/inner/src/x.c",
+		"/tree/root/docs/read me#1.txt":   "https://svn.example.com/repo/trunk/docs/read%20me%231.txt",
+		"/tree/root/libs/b/./sub/../b.c":  "https://svn.example.com/repo/libs/b/b.c",
+	} {
+		got, err := root.SvnUrlOf(p)
+		if err != nil {
+			t.Errorf("%s: %v", p, err)
+		} else if got != want {
+			t.Errorf("%s has url %s, want %s", p, got, want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Directory of svn's cached simple (username and password) credentials,
+// which git-svn shares. Each file is an svn hash of the credential fields.
+func svnAuthDir() string {
+	return filepath.Join(os.Getenv("HOME"), ".subversion", "auth", "svn.simple")
+}
+
+var defaultSvnPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"svn":   "3690",
+}
+
+// Return the realm prefix svn uses for a server root, "<scheme://host:port>".
+func realmPrefix(root string) string {
+	u, err := url.Parse(root)
+	if err != nil || u.Host == "" {
+		return "<" + root + ">"
+	}
+	host := u.Host
+	if u.Port() == "" {
+		if port, ok := defaultSvnPorts[u.Scheme]; ok {
+			host += ":" + port
+		}
+	}
+	return "<" + u.Scheme + "://" + host + ">"
+}
+
+// Parse an svn hash file: repeated "K <len>\n<key>\nV <len>\n<value>\n"
+// terminated by "END".
+func parseSvnHash(data []byte) (map[string]string, error) {
+	fields := make(map[string]string)
+	r := bufio.NewReader(bytes.NewReader(data))
+	readItem := func(kind string) (string, bool, error) {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", false, fmt.Errorf("truncated svn hash")
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "END" {
+			return "", true, nil
+		}
+		if !strings.HasPrefix(line, kind+" ") {
+			return "", false, fmt.Errorf("expected %s, got %q", kind, line)
+		}
+		n, err := strconv.Atoi(line[len(kind)+1:])
+		if err != nil || n < 0 {
+			return "", false, fmt.Errorf("bad length in %q", line)
+		}
+		buf := make([]byte, n+1)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", false, fmt.Errorf("truncated svn hash")
+		}
+		return string(buf[:n]), false, nil
+	}
+
+	for {
+		key, end, err := readItem("K")
+		if err != nil {
+			return nil, err
+		}
+		if end {
+			return fields, nil
+		}
+		value, _, err := readItem("V")
+		if err != nil {
+			return nil, err
+		}
+		fields[key] = value
+	}
+}
+
+// Return the cached username for each realm prefix in the svn auth cache.
+func cachedSvnUsers(dir string) (map[string]string, error) {
+	users := make(map[string]string)
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return users, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, fi := range files {
+		data, err := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		fields, err := parseSvnHash(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping svn credential %s: %v\n", fi.Name(), err)
+			continue
+		}
+		realm, user := fields["svn:realmstring"], fields["username"]
+		if i := strings.Index(realm, ">"); i >= 0 && user != "" {
+			users[realm[:i+1]] = user
+		}
+	}
+	return users, nil
+}
+
+// The identity git-svn uses with a server.
+type Identity struct {
+	Server string
+	User   string // Empty if no credential is cached
+	Repos  int
+}
+
+// Determine the svn username used with each server in the tree. A username
+// in the url takes precedence over the auth cache, as it does for svn.
+func (repo *Repo) Identities() ([]Identity, error) {
+	cached, err := cachedSvnUsers(svnAuthDir())
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []Identity
+	for _, server := range Servers(repo.Repos()) {
+		id := Identity{Server: server.Root, Repos: len(server.Repos)}
+		if u, err := url.Parse(server.Repos[0].Url); err == nil && u.User != nil {
+			id.User = u.User.Username()
+		} else {
+			id.User = cached[realmPrefix(server.Root)]
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func cmdWhoami(args []string, repo *Repo) error {
+	ids, err := repo.Identities()
+	if err != nil {
+		return err
+	}
+
+	var missing int
+	for _, id := range ids {
+		user := id.User
+		if user == "" {
+			user = "(no cached credential)"
+			missing++
+		}
+		fmt.Printf("%s\t%s\t%d repo(s)\n", id.Server, user, id.Repos)
+	}
+	if missing > 0 {
+		return fmt.Errorf("%d server(s) have no cached credential, try gish reauth", missing)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Encode fields as an svn hash file.
+func svnHash(fields ...string) string {
+	var s string
+	for i := 0; i+1 < len(fields); i += 2 {
+		s += fmt.Sprintf("K %d\n%s\nV %d\n%s\n", len(fields[i]), fields[i], len(fields[i+1]), fields[i+1])
+	}
+	return s + "END\n"
+}
+
+func TestParseSvnHash(t *testing.T) {
+	fields, err := parseSvnHash([]byte(svnHash("username", "alice", "svn:realmstring", "<https://svn.example.com:443> Two\nlines")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields["username"] != "alice" || fields["svn:realmstring"] != "<https://svn.example.com:443> Two\nlines" {
+		t.Errorf("parsed %q", fields)
+	}
+
+	for _, bad := range []string{"", "K 8\nusername\n", "K x\n", "V 1\na\nEND\n", "K 99\nshort\n"} {
+		if _, err := parseSvnHash([]byte(bad)); err == nil {
+			t.Errorf("parsed %q", bad)
+		}
+	}
+}
+
+func TestRealmPrefix(t *testing.T) {
+	for root, want := range map[string]string{
+		"https://svn.example.com":     "<https://svn.example.com:443>",
+		"http://svn.example.com:8080": "<http://svn.example.com:8080>",
+		"svn://other.example.com":     "<svn://other.example.com:3690>",
+		"svn+ssh://ssh.example.com":   "<svn+ssh://ssh.example.com>",
+		"file:///srv/svn/repo":        "<file:///srv/svn/repo>",
+	} {
+		if got := realmPrefix(root); got != want {
+			t.Errorf("realmPrefix(%s) = %s, want %s", root, got, want)
+		}
+	}
+}
+
+func TestIdentities(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := svnAuthDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		"0123abcd": svnHash("svn:realmstring", "<https://svn.example.com:443> Example", "username", "alice"),
+		"4567ef01": svnHash("svn:realmstring", "<svn://other.example.com:3690> Other", "username", "carol"),
+		"broken":   "K 4\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	root := testTree()
+	root.Externals[1].Url = "svn://bob@other.example.com/a"
+	ids, err := root.Identities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Identity{
+		{Server: "https://svn.example.com", User: "alice", Repos: 2},
+		{Server: "svn://other.example.com", User: "bob", Repos: 2},
+	}
+	if len(ids) != len(want) {
+		t.Fatalf("identities %+v, want %+v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Errorf("identity %+v, want %+v", ids[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Return the git dir of the repo: its .git directory, or for a worktree the
+// directory its .git file points to.
+func gitDir(repoPath string) string {
+	dotGit := path.Join(repoPath, ".git")
+	b, err := fsys.ReadFile(dotGit)
+	if err != nil {
+		return dotGit
+	}
+	dir := strings.TrimSpace(strings.TrimPrefix(string(b), "gitdir:"))
+	if !path.IsAbs(dir) {
+		dir = path.Join(repoPath, dir)
+	}
+	return dir
+}
+
+// Return the git dir holding what a worktree shares with the repo it was
+// added to, such as git-svn's metadata and info/exclude.
+func gitCommonDir(repoPath string) string {
+	dir := gitDir(repoPath)
+	b, err := fsys.ReadFile(path.Join(dir, "commondir"))
+	if err != nil {
+		return dir
+	}
+	common := strings.TrimSpace(string(b))
+	if !path.IsAbs(common) {
+		common = path.Join(dir, common)
+	}
+	return common
+}
+
+// Return a repo in the tree already cloned from the same svn url as the
+// repo, which can be shared with a worktree, or nil if there is none.
+func (repo *Repo) worktreeSource() *Repo {
+	treeMu.Lock()
+	defer treeMu.Unlock()
+	for _, r := range repo.Root.Repos() {
+		if r != repo && r.Url == repo.Url && r.Rev == repo.Rev && r.WorktreeOf == "" &&
+			IsRepo(r.Path) && isGitSvn(r.Path) {
+			return r
+		}
+	}
+	return nil
+}
+
+// Check out the repo as a worktree of src rather than cloning the same
+// history again.
+func (repo *Repo) addWorktree(src *Repo) error {
+	fmt.Printf("Adding %q as a worktree of %q, which has the same svn url\n", repo.Path, src.Path)
+	err := fsys.MkdirAll(path.Dir(repo.Path), 0770)
+	if err != nil {
+		return err
+	}
+	err = execCmd(src.Path, "git", "worktree", "add", "--detach", repo.Path, "HEAD")
+	if err != nil {
+		return err
+	}
+	repo.WorktreeOf = src.Path
+	return nil
+}
+
+// Point the worktrees in the tree back at their repos after the tree moved.
+func (repo *Repo) repairWorktrees() {
+	for _, r := range repo.Repos() {
+		if r.WorktreeOf == "" {
+			continue
+		}
+		err := execCmd(r.WorktreeOf, "git", "worktree", "repair", r.Path)
+		if err != nil {
+			fmt.Printf("Repairing worktree %s failed: %v\n", r.Path, err)
+		}
+	}
+}
+
+// Select the repos whose git dir has worktrees, whether added by gish or by
+// hand. Worktrees themselves are left out, their entries are in the repo
+// they were added to.
+func withWorktrees(repos []*Repo) []*Repo {
+	var selected []*Repo
+	for _, r := range repos {
+		if !IsRepo(r.Path) || gitCommonDir(r.Path) != gitDir(r.Path) {
+			continue
+		}
+		if IsDir(path.Join(gitDir(r.Path), "worktrees")) {
+			selected = append(selected, r)
+		}
+	}
+	return selected
+}
+
+// Run git worktree prune in the repos with worktrees, removing the entries of
+// worktrees whose directories were deleted.
+func cmdPruneWorktrees(args []string, repo *Repo) error {
+	var dryRun bool
+	flags := flag.NewFlagSet("prune-worktrees", flag.ContinueOnError)
+	flags.BoolVar(&dryRun, "n", false, "List the stale worktree entries without removing them.")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage:\n\tgish prune-worktrees [options]\n")
+		fmt.Fprint(os.Stderr, "\tRemove the entries of worktrees whose directories are gone, in each repo that has worktrees.\n")
+		fmt.Fprint(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+
+	repos := withWorktrees(repo.Repos())
+	if len(repos) == 0 {
+		fmt.Println("No repos have worktrees.")
+		return nil
+	}
+	pruneArgs := []string{"worktree", "prune", "-v"}
+	if dryRun {
+		pruneArgs = append(pruneArgs, "-n")
+	}
+	return Foreach(repos, pruneArgs)
+}
@@ -0,0 +1,84 @@
+package main
+
+import "testing"
+
+func TestGitDirs(t *testing.T) {
+	useMemFS(t)
+	makeRepo(t, "/tree/root")
+	if err := fsys.MkdirAll("/tree/root/.git/worktrees/wt", 0770); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.MkdirAll("/tree/wt", 0770); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		"/tree/wt/.git":                          "gitdir: /tree/root/.git/worktrees/wt\n",
+		"/tree/root/.git/worktrees/wt/commondir": "../..\n",
+	} {
+		if err := fsys.WriteFile(name, []byte(data), 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, c := range []struct{ repo, dir, common string }{
+		{"/tree/root", "/tree/root/.git", "/tree/root/.git"},
+		{"/tree/wt", "/tree/root/.git/worktrees/wt", "/tree/root/.git"},
+	} {
+		if got := gitDir(c.repo); got != c.dir {
+			t.Errorf("git dir of %s is %s, want %s", c.repo, got, c.dir)
+		}
+		if got := gitCommonDir(c.repo); got != c.common {
+			t.Errorf("common dir of %s is %s, want %s", c.repo, got, c.common)
+		}
+	}
+}
+
+func TestWorktreeSource(t *testing.T) {
+	useMemFS(t)
+	root := testTree()
+	b := &root.Externals[0]
+	root.Externals = append(root.Externals,
+		Repo{Path: "/tree/root/again/b", Url: b.Url},
+		Repo{Path: "/tree/root/pinned/b", Url: b.Url, Rev: "3"})
+	root.LinkRoot()
+	b, again, pinned := &root.Externals[0], &root.Externals[2], &root.Externals[3]
+
+	if src := again.worktreeSource(); src != nil {
+		t.Errorf("%s is a source before it's cloned", src.Path)
+	}
+	makeRepo(t, b.Path)
+	if err := fsys.MkdirAll(b.Path+"/.git/svn", 0770); err != nil {
+		t.Fatal(err)
+	}
+	if src := again.worktreeSource(); src != b {
+		t.Errorf("source of %s is %v", again.Path, src)
+	}
+	if src := pinned.worktreeSource(); src != nil {
+		t.Errorf("a repo pinned to another revision shares %s", src.Path)
+	}
+}
+
+func TestWithWorktrees(t *testing.T) {
+	useMemFS(t)
+	root := testTree()
+	makeRepo(t, root.Path)
+	makeRepo(t, root.Externals[0].Path)
+	if err := fsys.MkdirAll("/tree/root/.git/worktrees/wt", 0770); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.MkdirAll("/tree/root/wt", 0770); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile("/tree/root/wt/.git", []byte("gitdir: /tree/root/.git/worktrees/wt\n"), 0660); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile("/tree/root/.git/worktrees/wt/commondir", []byte("../..\n"), 0660); err != nil {
+		t.Fatal(err)
+	}
+
+	// The worktree's entry is in the root, so only the root is pruned.
+	repos := append(root.Repos(), &Repo{Path: "/tree/root/wt", Root: root})
+	if got := repoPaths(withWorktrees(repos)); len(got) != 1 || got[0] != "/tree/root" {
+		t.Errorf("selected %q, want only the root", got)
+	}
+}